@@ -11,3 +11,7 @@ type Command interface {
 // The value is kept out of the sane exit-code range so a command can never
 // return it as a real status.
 const RunResultHelp = -18511
+
+// RunResultProblems is the exit code for a check that ran but found
+// problems, so scripts can tell it apart from a failure to run at all.
+const RunResultProblems = 2
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -8,40 +9,56 @@ import (
 )
 
 // commandTable enumerates every subcommand: its full name, its constructor, and
-// the exact number of positional arguments its Run accepts. The whole cmd
-// package shares one wrapper shape, so this table drives the arg-validation and
-// help-contract checks for all of them at once.
+// the exact number of positional arguments its Run accepts, or the minimum if
+// it's variadic. The whole cmd package shares one wrapper shape, so this table
+// drives the arg-validation and help-contract checks for all of them at once.
 var commandTable = []struct {
-	name string
-	new  func(hclog.Logger) Command
-	argc int
+	name     string
+	new      func(hclog.Logger, string) Command
+	argc     int
+	variadic bool
 }{
-	{"init", DoInit, 0},
-	{"index add-files", IndexAddFiles, 2},
-	{"index add-google-photos-takeout", IndexAddGooglePhotosTakeout, 2},
-	{"index cat", IndexCat, 1},
-	{"index chunk", IndexChunk, 3},
-	{"index ls", IndexList, 0},
-	{"index materialize", IndexMaterialize, 2},
-	{"index rm", IndexDelete, 1},
-	{"index stats", IndexStats, 1},
-	{"set difference", SetDifference, 3},
-	{"set intersection", SetIntersection, 3},
-	{"set union", SetUnion, 3},
+	{"init", DoInit, 0, false},
+	{"dedupe", Dedupe, 1, false},
+	{"prune", Prune, 1, false},
+	{"restore-quarantine", RestoreQuarantine, 1, false},
+	{"index add-files", IndexAddFiles, 2, false},
+	{"index add-materialized", IndexAddMaterialized, 2, false},
+	{"index add-google-photos-takeout", IndexAddGooglePhotosTakeout, 2, false},
+	{"index cat", IndexCat, 1, false},
+	{"index chunk", IndexChunk, 3, false},
+	{"index compare", IndexCompare, 2, false},
+	{"index dupes", IndexDupes, 1, false},
+	{"index filter", IndexFilter, 2, false},
+	{"index ls", IndexList, 0, false},
+	{"index materialize", IndexMaterialize, 2, false},
+	{"index rebase", IndexRebase, 3, false},
+	{"index refresh", IndexRefresh, 2, false},
+	{"index rm", IndexDelete, 1, false},
+	{"index stats", IndexStats, 1, false},
+	{"index verify", IndexVerify, 1, false},
+	{"materialized verify", MaterializedVerify, 2, false},
+	{"whereis", func(logger hclog.Logger, _ string) Command { return Whereis(logger) }, 1, false},
+	{"set difference", SetDifference, 3, true},
+	{"set eval", SetEval, 2, false},
+	{"set intersection", SetIntersection, 3, true},
+	{"set symmetric-difference", SetSymmetricDifference, 3, true},
+	{"set union", SetUnion, 3, true},
 }
 
 // TestArgValidation checks that every command returns RunResultHelp for any arg
-// count other than the one it expects. The wrong-count check runs before any
-// core call, so no database is touched here.
+// count other than the one it expects, or fewer than a variadic one needs. The
+// wrong-count check runs before any core call, so no database is touched here.
 func TestArgValidation(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "venn.db")
 	logger := hclog.NewNullLogger()
 	for _, tc := range commandTable {
 		t.Run(tc.name, func(t *testing.T) {
 			for _, n := range []int{0, 1, 2, 3, 4} {
-				if n == tc.argc {
-					continue // the valid count would fall through to a core call
+				if n == tc.argc || tc.variadic && n > tc.argc {
+					continue // a valid count would fall through to a core call
 				}
-				got := tc.new(logger).Run(make([]string, n))
+				got := tc.new(logger, dbPath).Run(make([]string, n))
 				if got != RunResultHelp {
 					t.Errorf("%s: Run with %d args = %d, want RunResultHelp (%d)",
 						tc.name, n, got, RunResultHelp)
@@ -54,10 +71,11 @@ func TestArgValidation(t *testing.T) {
 // TestHelpContract locks in the shape the dispatcher relies on: a non-empty
 // synopsis and help text that starts with "Usage: venn ".
 func TestHelpContract(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "venn.db")
 	logger := hclog.NewNullLogger()
 	for _, tc := range commandTable {
 		t.Run(tc.name, func(t *testing.T) {
-			c := tc.new(logger)
+			c := tc.new(logger, dbPath)
 			if c.Synopsis() == "" {
 				t.Error("Synopsis() is empty")
 			}
@@ -69,10 +87,10 @@ func TestHelpContract(t *testing.T) {
 }
 
 // TestCoreFailureExit1 checks that a command whose core call fails returns exit
-// code 1 (not RunResultHelp, not a panic). A fresh working directory has no
-// venn.db, so any command that reads the database hits ErrNotInitialized.
+// code 1 (not RunResultHelp, not a panic). A fresh directory has no venn.db,
+// so any command that reads the database hits ErrNotInitialized.
 func TestCoreFailureExit1(t *testing.T) {
-	t.Chdir(t.TempDir())
+	dbPath := filepath.Join(t.TempDir(), "venn.db")
 	logger := hclog.NewNullLogger()
 
 	cases := []struct {
@@ -80,9 +98,9 @@ func TestCoreFailureExit1(t *testing.T) {
 		cmd  Command
 		args []string
 	}{
-		{"index ls", IndexList(logger), nil},
-		{"index stats", IndexStats(logger), []string{"idx"}},
-		{"set union", SetUnion(logger), []string{"result", "a", "b"}},
+		{"index ls", IndexList(logger, dbPath), nil},
+		{"index stats", IndexStats(logger, dbPath), []string{"idx"}},
+		{"set union", SetUnion(logger, dbPath), []string{"result", "a", "b"}},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
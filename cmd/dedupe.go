@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// Dedupe returns a Command for replacing duplicate files with links.
+func Dedupe(logger hclog.Logger, dbPath string) Command {
+	return &dedupe{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type dedupe struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *dedupe) Synopsis() string {
+	return "Replace duplicate files with links to one copy"
+}
+
+func (c *dedupe) Help() string {
+	return `Usage: venn dedupe [options] <indexName>
+
+Reclaim disk space by replacing the redundant copies of each duplicated file
+in an index with links to one canonical copy, in place.
+
+The canonical copy is the first path in sorted order. Every file is re-hashed
+before it is replaced, and files that no longer match the index are skipped,
+so a stale index can't cause data loss. Files are never linked across
+filesystems; instead each filesystem keeps its own canonical copy, and files
+whose filesystem can't be determined on this platform are skipped. The index
+is not changed, since every path still has the same content.
+
+Modes:
+  hardlink  Hard link to the canonical copy (the default)
+  reflink   Copy-on-write clone of the canonical copy, which needs a
+            filesystem with reflink support such as Btrfs or XFS
+  symlink   Symbolic link to the absolute path of the canonical copy
+
+Arguments:
+  indexName  Name of the index whose duplicates should be linked
+
+Options:
+  --mode M   Link mode: hardlink, reflink or symlink
+  --dry-run  Print what would be linked without changing any files
+
+Example:
+  venn dedupe --dry-run photos
+  venn dedupe photos --mode reflink
+`
+}
+
+func (c *dedupe) Run(args []string) int {
+	opts := core.DedupeOptions{Mode: core.LinkHardlink}
+	fs := newFlagSet("dedupe")
+	fs.Var((*linkModeValue)(&opts.Mode), "mode", "link mode: hardlink, reflink or symlink")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print what would be linked")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+
+	if err := core.Dedupe(c.logger, c.dbPath, indexName, opts); err != nil {
+		c.logger.Error("failed to dedupe index", "index", indexName, "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -7,31 +7,36 @@ import (
 	"github.com/slackpad/venn/core"
 )
 
-// DoInit returns a Command for initializing venn in the current directory.
-func DoInit(logger hclog.Logger) Command {
+// DoInit returns a Command for initializing a venn database.
+func DoInit(logger hclog.Logger, dbPath string) Command {
 	return &doInit{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type doInit struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *doInit) Synopsis() string {
-	return "Initialize venn in the current directory"
+	return "Initialize a new venn database"
 }
 
 func (c *doInit) Help() string {
 	return `Usage: venn init
 
-Initialize venn in the current directory by creating a new venn.db file.
+Initialize venn by creating a new database file.
 
-This command creates a new database for managing file indexes. If a database
-already exists, this command will fail.
+This command creates a new database for managing file indexes. The database is
+venn.db in the current directory unless another path is given with the global
+--db flag or the VENN_DB environment variable. If a database already exists,
+this command will fail.
 
 Example:
   venn init
+  venn --db ~/venn/photos.db init
 `
 }
 
@@ -41,7 +46,7 @@ func (c *doInit) Run(args []string) int {
 		return RunResultHelp
 	}
 
-	if err := core.CreateDB(c.logger); err != nil {
+	if err := core.CreateDB(c.logger, c.dbPath); err != nil {
 		c.logger.Error("failed to initialize database", "error", err)
 		return 1
 	}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"flag"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/slackpad/venn/core"
+)
+
+// newFlagSet returns a flag set for the named command. Parse errors are
+// returned rather than printed, so commands can log them and return
+// RunResultHelp like any other usage error.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses args with fs and returns the positional arguments. Unlike
+// fs.Parse, flags may appear before, between, or after the positional
+// arguments; everything after a "--" terminator is positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeatable
+// flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sizeValue is a flag.Value for a byte count with an optional unit suffix.
+type sizeValue int64
+
+func (s *sizeValue) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeValue) Set(value string) error {
+	n, err := core.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(n)
+	return nil
+}
+
+// formatValue is a flag.Value for an output format.
+type formatValue core.OutputFormat
+
+func (f *formatValue) String() string {
+	return string(*f)
+}
+
+func (f *formatValue) Set(value string) error {
+	format, err := core.ParseOutputFormat(value)
+	if err != nil {
+		return err
+	}
+	*f = formatValue(format)
+	return nil
+}
+
+// linkModeValue is a flag.Value for a link mode.
+type linkModeValue core.LinkMode
+
+func (m *linkModeValue) String() string {
+	return string(*m)
+}
+
+func (m *linkModeValue) Set(value string) error {
+	mode, err := core.ParseLinkMode(value)
+	if err != nil {
+		return err
+	}
+	*m = linkModeValue(mode)
+	return nil
+}
+
+// keepPolicyValue is a flag.Value for a prune keeper policy.
+type keepPolicyValue core.KeepPolicy
+
+func (p *keepPolicyValue) String() string {
+	return core.KeepPolicy(*p).String()
+}
+
+func (p *keepPolicyValue) Set(value string) error {
+	policy, err := core.ParseKeepPolicy(value)
+	if err != nil {
+		return err
+	}
+	*p = keepPolicyValue(policy)
+	return nil
+}
+
+// layoutValue is a flag.Value for a materialize layout.
+type layoutValue core.Layout
+
+func (l *layoutValue) String() string {
+	return core.Layout(*l).String()
+}
+
+func (l *layoutValue) Set(value string) error {
+	layout, err := core.ParseLayout(value)
+	if err != nil {
+		return err
+	}
+	*l = layoutValue(layout)
+	return nil
+}
+
+// addFormatFlag registers the --format flag, defaulting to a table.
+func addFormatFlag(fs *flag.FlagSet, format *core.OutputFormat) {
+	*format = core.FormatTable
+	fs.Var((*formatValue)(format), "format", "output format: table, json, jsonl or csv")
+}
+
+// addIndexAddFlags registers the flags shared by the commands that add files
+// to an index.
+func addIndexAddFlags(fs *flag.FlagSet, opts *core.IndexAddOptions) {
+	fs.IntVar(&opts.Workers, "workers", 0, "number of files to hash in parallel")
+	fs.BoolVar(&opts.Rehash, "rehash", false, "rehash files that look unchanged")
+	fs.Var((*stringList)(&opts.Include), "include", "only index files matching this glob")
+	fs.Var((*stringList)(&opts.Exclude), "exclude", "skip files and folders matching this glob")
+	fs.Var((*sizeValue)(&opts.MinSize), "min-size", "skip files smaller than this size")
+	fs.Var((*sizeValue)(&opts.MaxSize), "max-size", "skip files larger than this size")
+	fs.Var((*stringList)(&opts.ContentTypes), "content-type", "only index files with this content type prefix")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantWorkers int
+		wantArgs    []string
+		wantErr     bool
+	}{
+		{"no flags", []string{"a", "b"}, 0, []string{"a", "b"}, false},
+		{"leading flag", []string{"--workers", "4", "a", "b"}, 4, []string{"a", "b"}, false},
+		{"trailing flag", []string{"a", "b", "-workers=4"}, 4, []string{"a", "b"}, false},
+		{"interspersed flag", []string{"a", "--workers", "4", "b"}, 4, []string{"a", "b"}, false},
+		{"terminator", []string{"a", "--", "--workers"}, 0, []string{"a", "--workers"}, false},
+		{"empty positional", []string{"", ""}, 0, []string{"", ""}, false},
+		{"unknown flag", []string{"--bogus", "a"}, 0, nil, true},
+		{"bad value", []string{"--workers", "many"}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlagSet("test")
+			workers := fs.Int("workers", 0, "")
+
+			got, err := parseFlags(fs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *workers != tt.wantWorkers {
+				t.Errorf("workers = %d, want %d", *workers, tt.wantWorkers)
+			}
+			if len(got) != len(tt.wantArgs) {
+				t.Fatalf("parseFlags() = %q, want %q", got, tt.wantArgs)
+			}
+			for i := range got {
+				if got[i] != tt.wantArgs[i] {
+					t.Errorf("parseFlags() = %q, want %q", got, tt.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestStringList(t *testing.T) {
+	fs := newFlagSet("test")
+	var list []string
+	fs.Var((*stringList)(&list), "exclude", "")
+
+	got, err := parseFlags(fs, []string{"--exclude", "a", "x", "--exclude=b"})
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != "x" {
+		t.Errorf("parseFlags() = %q, want [x]", got)
+	}
+	if len(list) != 2 || list[0] != "a" || list[1] != "b" {
+		t.Errorf("list = %q, want [a b]", list)
+	}
+}
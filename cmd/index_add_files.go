@@ -6,14 +6,16 @@ import (
 )
 
 // IndexAddFiles returns a Command for adding files to an index.
-func IndexAddFiles(logger hclog.Logger) Command {
+func IndexAddFiles(logger hclog.Logger, dbPath string) Command {
 	return &indexAddFiles{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexAddFiles struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexAddFiles) Synopsis() string {
@@ -21,7 +23,7 @@ func (c *indexAddFiles) Synopsis() string {
 }
 
 func (c *indexAddFiles) Help() string {
-	return `Usage: venn index add-files <indexName> <rootPath>
+	return `Usage: venn index add-files [options] <indexName> <rootPath>
 
 Recursively scan all files in a folder tree and add them to an index.
 
@@ -29,16 +31,52 @@ The index will be created if it doesn't exist. If it already exists, new files
 will be added to it. Files are identified by their SHA-256 hash, so duplicate
 files across multiple paths will be tracked efficiently.
 
+Files are hashed in parallel and written to the index in batches, so an
+interrupted scan keeps the files indexed so far. Files whose size,
+modification time and inode are unchanged since they were last added to the
+index are not hashed again unless --rehash is given.
+
+Globs are gitignore-style and matched against paths relative to rootPath. A
+glob without a slash matches a name at any depth, "**" matches any number of
+folders, and a trailing slash only matches folders. Exclude globs are also read
+from a .vennignore file in rootPath, one per line, if it exists.
+
+Sizes accept KB, MB, GB and TB suffixes in powers of 1024, and are checked
+before a file is hashed. Content types are detected from the first 512 bytes
+of a file; smaller files are always application/octet-stream.
+
 Arguments:
   indexName  Name of the index to create or update
   rootPath   Path to the root folder to scan
 
+Options:
+  --workers N         Files to hash in parallel (default: one per CPU)
+  --rehash            Rehash every file, even ones unchanged since the last scan
+  --include G         Only index files matching glob G (repeatable)
+  --exclude G         Skip files and folders matching glob G (repeatable)
+  --min-size S        Skip files smaller than S, such as 10KB
+  --max-size S        Skip files larger than S, such as 4GB
+  --content-type T    Only index files whose content type starts with T, such
+                      as image/ (repeatable)
+
 Example:
   venn index add-files photos /home/user/Pictures
+  venn index add-files --workers 16 photos /mnt/nas/Pictures
+  venn index add-files --exclude @eaDir/ --exclude .DS_Store photos /mnt/nas/Pictures
+  venn index add-files --min-size 10KB --content-type image/ --content-type video/ media ~/
 `
 }
 
 func (c *indexAddFiles) Run(args []string) int {
+	var opts core.IndexAddOptions
+	fs := newFlagSet("index add-files")
+	addIndexAddFlags(fs, &opts)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
 	if len(args) != 2 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
@@ -47,7 +85,7 @@ func (c *indexAddFiles) Run(args []string) int {
 	indexName := args[0]
 	rootPath := args[1]
 
-	if err := core.IndexAddFiles(c.logger, indexName, rootPath); err != nil {
+	if err := core.IndexAddFiles(c.logger, c.dbPath, indexName, rootPath, opts); err != nil {
 		c.logger.Error("failed to add files to index", "index", indexName, "path", rootPath, "error", err)
 		return 1
 	}
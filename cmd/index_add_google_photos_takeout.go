@@ -6,14 +6,16 @@ import (
 )
 
 // IndexAddGooglePhotosTakeout returns a Command for adding files from a Google Photos Takeout.
-func IndexAddGooglePhotosTakeout(logger hclog.Logger) Command {
+func IndexAddGooglePhotosTakeout(logger hclog.Logger, dbPath string) Command {
 	return &indexAddGooglePhotosTakeout{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexAddGooglePhotosTakeout struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexAddGooglePhotosTakeout) Synopsis() string {
@@ -21,7 +23,7 @@ func (c *indexAddGooglePhotosTakeout) Synopsis() string {
 }
 
 func (c *indexAddGooglePhotosTakeout) Help() string {
-	return `Usage: venn index add-google-photos-takeout <indexName> <rootPath>
+	return `Usage: venn index add-google-photos-takeout [options] <indexName> <rootPath>
 
 Recursively scan files from a Google Photos Takeout and add them to an index.
 
@@ -30,18 +32,41 @@ will extract timestamps from the JSON metadata files that accompany photos
 and attach those metadata files to the indexed entries for materialization.
 
 The index will be created if it doesn't exist. If it already exists, new files
-will be added to it.
+will be added to it. Files unchanged since the last scan are skipped, so use
+--rehash to pick up edited metadata files.
+
+See "venn index add-files -h" for the glob syntax used by --include and
+--exclude; a .vennignore file in rootPath is honored as well.
 
 Arguments:
   indexName  Name of the index to create or update
   rootPath   Path to the extracted Google Photos Takeout folder
 
+Options:
+  --workers N         Files to hash in parallel (default: one per CPU)
+  --rehash            Rehash every file, even ones unchanged since the last scan
+  --include G         Only index files matching glob G (repeatable)
+  --exclude G         Skip files and folders matching glob G (repeatable)
+  --min-size S        Skip files smaller than S, such as 10KB
+  --max-size S        Skip files larger than S, such as 4GB
+  --content-type T    Only index files whose content type starts with T, such
+                      as image/ (repeatable)
+
 Example:
   venn index add-google-photos-takeout photos ~/Downloads/GooglePhotosTakeout
 `
 }
 
 func (c *indexAddGooglePhotosTakeout) Run(args []string) int {
+	var opts core.IndexAddOptions
+	fs := newFlagSet("index add-google-photos-takeout")
+	addIndexAddFlags(fs, &opts)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
 	if len(args) != 2 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
@@ -50,7 +75,7 @@ func (c *indexAddGooglePhotosTakeout) Run(args []string) int {
 	indexName := args[0]
 	rootPath := args[1]
 
-	if err := core.IndexAddGooglePhotosTakeout(c.logger, indexName, rootPath); err != nil {
+	if err := core.IndexAddGooglePhotosTakeout(c.logger, c.dbPath, indexName, rootPath, opts); err != nil {
 		c.logger.Error("failed to add Google Photos takeout to index", "index", indexName, "path", rootPath, "error", err)
 		return 1
 	}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexAddMaterialized returns a Command for indexing a materialized tree.
+func IndexAddMaterialized(logger hclog.Logger, dbPath string) Command {
+	return &indexAddMaterialized{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexAddMaterialized struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexAddMaterialized) Synopsis() string {
+	return "Add a materialized tree to an index without re-hashing"
+}
+
+func (c *indexAddMaterialized) Help() string {
+	return `Usage: venn index add-materialized [options] <indexName> <rootPath>
+
+Scan a folder tree written by "venn index materialize" and add its files to an
+index, trusting the <hash><ext> names instead of reading every file. Only the
+first 512 bytes of each file are read to detect its content type, so an old
+backup on an external drive can be indexed and used in set operations in a
+fraction of the time add-files would take.
+
+A file named <hash>.json next to a file with the same hash is added as its
+attachment. Files that aren't named by a hash, the manifest, and temporary
+files left by an interrupted materialize are skipped.
+
+With --verify every file is re-hashed instead, and a file whose content doesn't
+match its name is skipped with a warning. Use "venn materialized verify" to get
+a full report of a tree's problems.
+
+The index will be created if it doesn't exist. The scan options work the same
+as for add-files.
+
+Arguments:
+  indexName  Name of the index to create or update
+  rootPath   Root of the materialized tree
+
+Options:
+  --verify            Re-hash files instead of trusting their names
+  --workers N         Files to read in parallel (default: one per CPU)
+  --rehash            Read every file, even ones unchanged since the last scan
+  --include G         Only index files matching glob G (repeatable)
+  --exclude G         Skip files and folders matching glob G (repeatable)
+  --min-size S        Skip files smaller than S, such as 10KB
+  --max-size S        Skip files larger than S, such as 4GB
+  --content-type T    Only index files whose content type starts with T, such
+                      as image/ (repeatable)
+
+Example:
+  venn index add-materialized backup-2019 /mnt/external/photos
+  venn index add-materialized --verify backup-2019 /mnt/external/photos
+`
+}
+
+func (c *indexAddMaterialized) Run(args []string) int {
+	var (
+		opts   core.IndexAddOptions
+		verify bool
+	)
+	fs := newFlagSet("index add-materialized")
+	fs.BoolVar(&verify, "verify", false, "re-hash files instead of trusting their names")
+	addIndexAddFlags(fs, &opts)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	rootPath := args[1]
+
+	if err := core.IndexAddMaterialized(c.logger, c.dbPath, indexName, rootPath, verify, opts); err != nil {
+		c.logger.Error("failed to add materialized tree to index", "index", indexName, "path", rootPath, "error", err)
+		return 1
+	}
+
+	c.logger.Info("files added successfully", "index", indexName)
+	return 0
+}
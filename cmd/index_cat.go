@@ -6,14 +6,16 @@ import (
 )
 
 // IndexCat returns a Command for listing files in an index.
-func IndexCat(logger hclog.Logger) Command {
+func IndexCat(logger hclog.Logger, dbPath string) Command {
 	return &indexCat{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexCat struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexCat) Synopsis() string {
@@ -21,23 +23,40 @@ func (c *indexCat) Synopsis() string {
 }
 
 func (c *indexCat) Help() string {
-	return `Usage: venn index cat <indexName>
+	return `Usage: venn index cat [options] <indexName>
 
-Display the contents of an index in a table format.
+Display the contents of an index.
 
 This command shows all files in the specified index, including their SHA-256
 hash, size, timestamp, content type, and associated file paths. Files with
 the same hash (duplicates) are shown together.
 
+The json and jsonl formats print one object per hash with every path and
+attachment; jsonl writes one object per line as the index is read, so it
+suits very large indexes. The csv format prints one row per path.
+
 Arguments:
   indexName  Name of the index to display
 
+Options:
+  --format F  Output format: table (default), json, jsonl or csv
+
 Example:
   venn index cat photos
+  venn index cat --format jsonl photos > photos.jsonl
 `
 }
 
 func (c *indexCat) Run(args []string) int {
+	var format core.OutputFormat
+	fs := newFlagSet("index cat")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
 	if len(args) != 1 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
@@ -45,7 +64,7 @@ func (c *indexCat) Run(args []string) int {
 
 	indexName := args[0]
 
-	if err := core.IndexCat(c.logger, indexName); err != nil {
+	if err := core.IndexCat(c.logger, c.dbPath, indexName, format); err != nil {
 		c.logger.Error("failed to display index", "index", indexName, "error", err)
 		return 1
 	}
@@ -8,14 +8,16 @@ import (
 )
 
 // IndexChunk returns a Command for splitting an index into smaller chunks.
-func IndexChunk(logger hclog.Logger) Command {
+func IndexChunk(logger hclog.Logger, dbPath string) Command {
 	return &indexChunk{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexChunk struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexChunk) Synopsis() string {
@@ -55,7 +57,7 @@ func (c *indexChunk) Run(args []string) int {
 		return 1
 	}
 
-	if err := core.IndexChunk(c.logger, indexName, targetIndexPrefix, chunkSize); err != nil {
+	if err := core.IndexChunk(c.logger, c.dbPath, indexName, targetIndexPrefix, chunkSize); err != nil {
 		c.logger.Error("failed to chunk index", "index", indexName, "error", err)
 		return 1
 	}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexCompare returns a Command for comparing two indexes.
+func IndexCompare(logger hclog.Logger, dbPath string) Command {
+	return &indexCompare{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexCompare struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexCompare) Synopsis() string {
+	return "Show what is only in A, only in B and in both"
+}
+
+func (c *indexCompare) Help() string {
+	return `Usage: venn index compare [options] <indexNameA> <indexNameB>
+
+Compare two indexes by content, like a diff of two whole backups.
+
+Files are matched by SHA-256 hash, not by path, so a file that was moved or
+renamed between backups is still in both. The number of hashes and bytes only
+in A, only in B and in both are printed. Neither index is modified.
+
+The entries in each group can also be listed. Listed entries that are in both
+indexes show their paths from both. With a listing, the json, jsonl and csv
+formats print only the listed entries, each tagged with its group of only_a,
+only_b or both; without one they print the counts.
+
+Arguments:
+  indexNameA  First index
+  indexNameB  Second index
+
+Options:
+  --only-a    List the files only in A
+  --only-b    List the files only in B
+  --both      List the files in both
+  --format F  Output format: table (default), json, jsonl or csv
+
+Example:
+  venn index compare backup_2023 backup_2024
+  venn index compare --only-a --format csv backup_2023 backup_2024 > lost.csv
+`
+}
+
+func (c *indexCompare) Run(args []string) int {
+	var (
+		opts   core.CompareOptions
+		format core.OutputFormat
+	)
+	fs := newFlagSet("index compare")
+	fs.BoolVar(&opts.ListOnlyA, "only-a", false, "list the files only in A")
+	fs.BoolVar(&opts.ListOnlyB, "only-b", false, "list the files only in B")
+	fs.BoolVar(&opts.ListBoth, "both", false, "list the files in both")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexA := args[0]
+	indexB := args[1]
+
+	if err := core.IndexCompare(c.logger, c.dbPath, indexA, indexB, opts, format); err != nil {
+		c.logger.Error("failed to compare indexes", "A", indexA, "B", indexB, "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -6,14 +6,16 @@ import (
 )
 
 // IndexDelete returns a Command for deleting an index.
-func IndexDelete(logger hclog.Logger) Command {
+func IndexDelete(logger hclog.Logger, dbPath string) Command {
 	return &indexDelete{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexDelete struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexDelete) Synopsis() string {
@@ -44,7 +46,7 @@ func (c *indexDelete) Run(args []string) int {
 
 	indexName := args[0]
 
-	if err := core.IndexDelete(c.logger, indexName); err != nil {
+	if err := core.IndexDelete(c.logger, c.dbPath, indexName); err != nil {
 		c.logger.Error("failed to delete index", "index", indexName, "error", err)
 		return 1
 	}
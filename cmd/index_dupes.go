@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexDupes returns a Command for reporting duplicate files in an index.
+func IndexDupes(logger hclog.Logger, dbPath string) Command {
+	return &indexDupes{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexDupes struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexDupes) Synopsis() string {
+	return "List duplicated files in an index"
+}
+
+func (c *indexDupes) Help() string {
+	return `Usage: venn index dupes [options] <indexName>
+
+List every hash in an index that has more than one path, along with all of its
+paths.
+
+Each duplicate reports its size, number of copies and wasted bytes, which is
+the size times the number of redundant copies. By default duplicates are
+sorted by wasted bytes, largest first, and a table ends with the total.
+
+Arguments:
+  indexName  Name of the index to check
+
+Options:
+  --min-size S  Skip files smaller than S, such as 1MB
+  --top N       Only list the first N duplicates
+  --sort O      Sort by wasted (default), count or hash
+  --format F    Output format: table (default), json, jsonl or csv
+
+Example:
+  venn index dupes photos
+  venn index dupes --min-size 1MB --top 20 photos
+  venn index dupes --format json photos > dupes.json
+`
+}
+
+func (c *indexDupes) Run(args []string) int {
+	var (
+		opts   core.DupesOptions
+		format core.OutputFormat
+	)
+	fs := newFlagSet("index dupes")
+	fs.Var((*sizeValue)(&opts.MinSize), "min-size", "skip files smaller than this size")
+	fs.IntVar(&opts.Top, "top", 0, "only list the first N duplicates")
+	fs.StringVar(&opts.Sort, "sort", core.DupesSortWasted, "sort order: wasted, count or hash")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+
+	if err := core.IndexDupes(c.logger, c.dbPath, indexName, opts, format); err != nil {
+		c.logger.Error("failed to list duplicates", "index", indexName, "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexFilter returns a Command for filtering an index into a new one.
+func IndexFilter(logger hclog.Logger, dbPath string) Command {
+	return &indexFilter{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexFilter struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexFilter) Synopsis() string {
+	return "Create a new index with the entries matching a predicate"
+}
+
+func (c *indexFilter) Help() string {
+	return `Usage: venn index filter [options] <indexName> <sourceIndexName>
+
+Create a new index with the entries of a source index that match a predicate.
+
+This splits an index by type, date, size or location without scanning the disk
+again. Matching entries are copied whole, with all their paths and
+attachments, and the source index is not modified. The new index must not
+already exist.
+
+Fields and the operators they support:
+  size          =, !=, <, <=, >, >= a size such as 512, 10KB or 1.5GB
+  timestamp     =, !=, <, <=, >, >= a date (YYYY-MM-DD, local time) or an
+                RFC 3339 timestamp
+  dup_count     =, !=, <, <=, >, >= the number of paths with the same hash
+  content_type  =, != a string, ~ a regular expression, glob a pattern
+  path          =, ~ a regular expression, glob a gitignore-style pattern;
+                true if any of the entry's paths match
+
+The has_attachment(".json") test is true for entries with an attachment with
+that extension. Tests can be combined with and, or, not and parentheses, with
+not binding tightest and or loosest. Values with spaces or any of "=!<>~()"
+must be double quoted. Quote the whole predicate so the shell doesn't
+interpret it.
+
+Arguments:
+  indexName        Name of the new index to create with the result
+  sourceIndexName  Index to filter
+
+Options:
+  --where P  Predicate entries must match; repeat to require all of them
+
+Example:
+  venn index filter big_photos photos --where 'size > 1MB and content_type ~ "^image/"'
+  venn index filter old photos --where 'timestamp < 2015-01-01'
+  venn index filter camera photos --where 'path glob "**/DCIM/**"' --where 'not has_attachment(".json")'
+`
+}
+
+func (c *indexFilter) Run(args []string) int {
+	var where []string
+	fs := newFlagSet("index filter")
+	fs.Var((*stringList)(&where), "where", "predicate entries must match")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+	if len(where) == 0 {
+		c.logger.Error("at least one --where predicate is required")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	sourceIndexName := args[1]
+
+	if err := core.IndexFilter(c.logger, c.dbPath, indexName, sourceIndexName, where); err != nil {
+		c.logger.Error("failed to filter index", "result", indexName, "source", sourceIndexName, "error", err)
+		return 1
+	}
+
+	c.logger.Info("index filter completed successfully", "result", indexName)
+	return 0
+}
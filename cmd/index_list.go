@@ -6,14 +6,16 @@ import (
 )
 
 // IndexList returns a Command for listing all indexes.
-func IndexList(logger hclog.Logger) Command {
+func IndexList(logger hclog.Logger, dbPath string) Command {
 	return &indexList{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexList struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexList) Synopsis() string {
@@ -21,24 +23,37 @@ func (c *indexList) Synopsis() string {
 }
 
 func (c *indexList) Help() string {
-	return `Usage: venn index ls
+	return `Usage: venn index ls [options]
 
 List all indexes in the database.
 
 This command displays the names of all indexes that have been created.
 
+Options:
+  --format F  Output format: table (default), json, jsonl or csv
+
 Example:
   venn index ls
+  venn index ls --format json
 `
 }
 
 func (c *indexList) Run(args []string) int {
+	var format core.OutputFormat
+	fs := newFlagSet("index ls")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
 	if len(args) != 0 {
 		c.logger.Error("index ls command takes no arguments")
 		return RunResultHelp
 	}
 
-	if err := core.IndexList(c.logger); err != nil {
+	if err := core.IndexList(c.logger, c.dbPath, format); err != nil {
 		c.logger.Error("failed to list indexes", "error", err)
 		return 1
 	}
@@ -6,14 +6,16 @@ import (
 )
 
 // IndexMaterialize returns a Command for materializing an index to a folder.
-func IndexMaterialize(logger hclog.Logger) Command {
+func IndexMaterialize(logger hclog.Logger, dbPath string) Command {
 	return &indexMaterialize{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexMaterialize struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexMaterialize) Synopsis() string {
@@ -21,25 +23,86 @@ func (c *indexMaterialize) Synopsis() string {
 }
 
 func (c *indexMaterialize) Help() string {
-	return `Usage: venn index materialize <indexName> <rootPath>
+	return `Usage: venn index materialize [options] <indexName> <rootPath>
+       venn index materialize [options] --archive <file> <indexName>
 
-Copy all indexed files to a target directory without duplicates.
+Copy or link all indexed files to a target directory without duplicates.
 
-This command creates a content-addressable layout where files are organized by
-their SHA-256 hash. Files with the same content (hash) will only be copied once,
-regardless of how many times they appear in the index. The directory structure
-uses the first bytes of the hash for organization.
+Files with the same content (hash) are only placed once, with their
+attachments next to them. Every source is checked against its hash first, and
+a .venn-manifest.jsonl at the root maps each file back to its hash and
+original paths for "venn whereis". Existing files are kept unless --sync is
+given, which re-checks them and removes files that aren't in the index.
+
+Layouts:
+  hash      <hh>/<hh>/<hash><ext> (the default)
+  date      YYYY/MM/DD/<name>, from the indexed timestamp in local time
+  original  The source path, relative to the folder holding all sources
+
+Any other layout is a template made of these fields:
+  {hash} {hash8} {hashdir}  Full hash, its first 8 digits, or <hh>/<hh>
+  {year} {month} {day}      Parts of the indexed timestamp
+  {name} {basename} {ext}   Source file name, without extension, extension
+  {dir}                     Source folder, relative to the sources
 
 Arguments:
   indexName  Name of the index to materialize
   rootPath   Path to the target folder
 
+Options:
+  --layout L       Layout preset or template (see above)
+  --link M         copy (default), hardlink, reflink or symlink
+  --no-verify      Skip checking sources against their hashes
+  --workers N      Files to place in parallel (default: one per CPU)
+  --resume         Skip the files the last run into rootPath finished
+  --archive F      Write a .tar, .zip or .tar.zst archive instead of a folder
+  --sync           Verify existing files and remove files not in the index
+  --quarantine D   With --sync, move extra files into D instead of deleting
+  --dry-run        With --sync, only list what would be removed
+
 Example:
   venn index materialize cleaned_photos /backup/photos
+  venn index materialize --layout date --link hardlink cleaned_photos /photos
+  venn index materialize --archive photos.tar.zst cleaned_photos
+  venn index materialize --sync --dry-run cleaned_photos /backup/photos
 `
 }
 
 func (c *indexMaterialize) Run(args []string) int {
+	opts := core.MaterializeOptions{Layout: core.HashLayout, Link: core.LinkCopy}
+	fs := newFlagSet("index materialize")
+	fs.Var((*layoutValue)(&opts.Layout), "layout", "layout preset or template")
+	fs.Var((*linkModeValue)(&opts.Link), "link", "link mode: copy, hardlink, reflink or symlink")
+	fs.BoolVar(&opts.NoVerify, "no-verify", false, "skip checking sources against their hashes")
+	fs.IntVar(&opts.Workers, "workers", 0, "number of files to place in parallel")
+	fs.BoolVar(&opts.Resume, "resume", false, "skip files the last run finished")
+	fs.BoolVar(&opts.Sync, "sync", false, "verify existing files and remove files not in the index")
+	fs.StringVar(&opts.Quarantine, "quarantine", "", "directory to move extra files into")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "with --sync, list what would be removed")
+	archivePath := fs.String("archive", "", "archive to write instead of a folder")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if *archivePath != "" {
+		if len(args) != 1 {
+			c.logger.Error("incorrect number of arguments")
+			return RunResultHelp
+		}
+
+		indexName := args[0]
+
+		if err := core.MaterializeArchive(c.logger, c.dbPath, indexName, *archivePath, opts); err != nil {
+			c.logger.Error("failed to materialize index", "index", indexName, "archive", *archivePath, "error", err)
+			return 1
+		}
+
+		c.logger.Info("index materialized successfully", "index", indexName, "archive", *archivePath)
+		return 0
+	}
+
 	if len(args) != 2 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
@@ -48,7 +111,7 @@ func (c *indexMaterialize) Run(args []string) int {
 	indexName := args[0]
 	rootPath := args[1]
 
-	if err := core.Materialize(c.logger, indexName, rootPath); err != nil {
+	if err := core.Materialize(c.logger, c.dbPath, indexName, rootPath, opts); err != nil {
 		c.logger.Error("failed to materialize index", "index", indexName, "path", rootPath, "error", err)
 		return 1
 	}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexRebase returns a Command for moving an index's paths to a new prefix.
+func IndexRebase(logger hclog.Logger, dbPath string) Command {
+	return &indexRebase{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexRebase struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexRebase) Synopsis() string {
+	return "Rewrite the paths in an index from one prefix to another"
+}
+
+func (c *indexRebase) Help() string {
+	return `Usage: venn index rebase [options] <indexName> <oldPrefix> <newPrefix>
+
+Rewrite the paths in an index that start with one prefix to start with another.
+
+Use this when the files in an index move, such as when a drive that was mounted
+at /media/olddrive is now mounted at /mnt/backup, so that materialize and
+refresh find them again. File paths, attachment paths and the recorded state of
+each file are all rewritten in a single transaction, so an interrupted rebase
+changes nothing.
+
+Prefixes match whole path components, so /media/old doesn't match
+/media/older, and are compared the way the paths were recorded when they were
+added. A summary of the paths and attachments rewritten, and how many of them
+exist at their new location, is printed. The rebase fails if a new path is
+already in the index.
+
+Arguments:
+  indexName  Name of the index to rewrite
+  oldPrefix  Path prefix the files used to be under
+  newPrefix  Path prefix the files are under now
+
+Options:
+  --dry-run  Print the summary without changing the index
+
+Example:
+  venn index rebase --dry-run backup /media/olddrive /mnt/backup
+  venn index rebase backup /media/olddrive /mnt/backup
+`
+}
+
+func (c *indexRebase) Run(args []string) int {
+	var dryRun bool
+	fs := newFlagSet("index rebase")
+	fs.BoolVar(&dryRun, "dry-run", false, "print the summary without changing the index")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 3 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	oldPrefix := args[1]
+	newPrefix := args[2]
+
+	if err := core.IndexRebase(c.logger, c.dbPath, indexName, oldPrefix, newPrefix, dryRun); err != nil {
+		c.logger.Error("failed to rebase index", "index", indexName, "old", oldPrefix, "new", newPrefix, "error", err)
+		return 1
+	}
+
+	if !dryRun {
+		c.logger.Info("index rebased successfully", "index", indexName)
+	}
+	return 0
+}
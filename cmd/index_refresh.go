@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexRefresh returns a Command for re-scanning a folder already in an index.
+func IndexRefresh(logger hclog.Logger, dbPath string) Command {
+	return &indexRefresh{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexRefresh struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexRefresh) Synopsis() string {
+	return "Re-scan a folder and prune deleted or changed files"
+}
+
+func (c *indexRefresh) Help() string {
+	return `Usage: venn index refresh [options] <indexName> <rootPath>
+
+Re-scan a folder tree that was previously added to an index.
+
+New files are added to the index, and files whose content changed are moved to
+their new hash. Paths under the root folder that no longer exist are removed,
+and entries left without any paths are deleted. A summary of added, changed
+and removed paths is printed when the refresh completes.
+
+The root path should be given the same way it was when the files were added,
+since paths are compared as they were recorded. A root that was added with
+add-google-photos-takeout is re-scanned as a takeout, so metadata files stay
+attached to their photos.
+
+Arguments:
+  indexName  Name of an existing index to refresh
+  rootPath   Path to the root folder to re-scan
+
+Options:
+  --workers N         Files to hash in parallel (default: one per CPU)
+  --rehash            Rehash every file, even ones unchanged since the last scan
+  --include G         Only index files matching glob G (repeatable)
+  --exclude G         Skip files and folders matching glob G (repeatable)
+  --min-size S        Skip files smaller than S, such as 10KB
+  --max-size S        Skip files larger than S, such as 4GB
+  --content-type T    Only index files whose content type starts with T, such
+                      as image/ (repeatable)
+
+Example:
+  venn index refresh photos /home/user/Pictures
+`
+}
+
+func (c *indexRefresh) Run(args []string) int {
+	var opts core.IndexAddOptions
+	fs := newFlagSet("index refresh")
+	addIndexAddFlags(fs, &opts)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	rootPath := args[1]
+
+	if err := core.IndexRefresh(c.logger, c.dbPath, indexName, rootPath, opts); err != nil {
+		c.logger.Error("failed to refresh index", "index", indexName, "path", rootPath, "error", err)
+		return 1
+	}
+
+	c.logger.Info("index refreshed successfully", "index", indexName)
+	return 0
+}
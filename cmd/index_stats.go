@@ -6,14 +6,16 @@ import (
 )
 
 // IndexStats returns a Command for displaying statistics about an index.
-func IndexStats(logger hclog.Logger) Command {
+func IndexStats(logger hclog.Logger, dbPath string) Command {
 	return &indexStats{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type indexStats struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *indexStats) Synopsis() string {
@@ -21,7 +23,7 @@ func (c *indexStats) Synopsis() string {
 }
 
 func (c *indexStats) Help() string {
-	return `Usage: venn index stats <indexName>
+	return `Usage: venn index stats [options] <indexName>
 
 Display statistics about an index including file counts, sizes, and types.
 
@@ -32,15 +34,31 @@ This command shows:
 - Total size in bytes
 - Distribution of file types
 
+The json and jsonl formats print the totals along with the same counts for
+each content type. The csv format prints one row per content type.
+
 Arguments:
   indexName  Name of the index to analyze
 
+Options:
+  --format F  Output format: table (default), json, jsonl or csv
+
 Example:
   venn index stats photos
+  venn index stats --format json photos
 `
 }
 
 func (c *indexStats) Run(args []string) int {
+	var format core.OutputFormat
+	fs := newFlagSet("index stats")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
 	if len(args) != 1 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
@@ -48,7 +66,7 @@ func (c *indexStats) Run(args []string) int {
 
 	indexName := args[0]
 
-	if err := core.IndexStats(c.logger, indexName); err != nil {
+	if err := core.IndexStats(c.logger, c.dbPath, indexName, format); err != nil {
 		c.logger.Error("failed to display index statistics", "index", indexName, "error", err)
 		return 1
 	}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// IndexVerify returns a Command for checking an index against the disk.
+func IndexVerify(logger hclog.Logger, dbPath string) Command {
+	return &indexVerify{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type indexVerify struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *indexVerify) Synopsis() string {
+	return "Re-hash indexed files to find missing or changed ones"
+}
+
+func (c *indexVerify) Help() string {
+	return `Usage: venn index verify [options] <indexName>
+
+Check that every path in an index still holds the content it was indexed
+with. Each path is re-read and re-hashed, and every path that is missing,
+unreadable, a different size, or has a different hash is listed. Attachments
+are checked for being readable, since they aren't hashed.
+
+Large indexes can be checked a piece at a time with --sample, which checks a
+random percentage of paths on each run, so regular runs cover the whole index
+over time. The --quick option skips hashing and only compares sizes and, for
+paths scanned by index add-files, modification times.
+
+Exit codes:
+  0  Every checked path matches the index
+  1  The check couldn't run
+  2  Some paths don't match the index
+
+Arguments:
+  indexName  Name of the index to verify
+
+Options:
+  --sample P   Check a random P percent of paths (default: all of them)
+  --quick      Compare sizes and modification times instead of hashing
+  --workers N  Files to hash in parallel (default: one per CPU)
+  --format F   Output format: table (default), json, jsonl or csv
+
+Example:
+  venn index verify photos
+  venn index verify --sample 5 --format jsonl photos
+`
+}
+
+func (c *indexVerify) Run(args []string) int {
+	var (
+		opts   core.VerifyOptions
+		format core.OutputFormat
+	)
+	fs := newFlagSet("index verify")
+	fs.Float64Var(&opts.Sample, "sample", 0, "percentage of paths to check")
+	fs.BoolVar(&opts.Quick, "quick", false, "compare sizes and modification times only")
+	fs.IntVar(&opts.Workers, "workers", 0, "number of files to hash in parallel")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+
+	if err := core.IndexVerify(c.logger, c.dbPath, indexName, opts, format); err != nil {
+		if errors.Is(err, core.ErrVerifyFailed) {
+			c.logger.Error("index does not match the files on disk", "index", indexName, "error", err)
+			return RunResultProblems
+		}
+		c.logger.Error("failed to verify index", "index", indexName, "error", err)
+		return 1
+	}
+
+	return 0
+}
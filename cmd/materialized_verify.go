@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// MaterializedVerify returns a Command for checking a materialized tree
+// against its index.
+func MaterializedVerify(logger hclog.Logger, dbPath string) Command {
+	return &materializedVerify{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type materializedVerify struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *materializedVerify) Synopsis() string {
+	return "Check a materialized tree for corrupt, missing or extra files"
+}
+
+func (c *materializedVerify) Help() string {
+	return `Usage: venn materialized verify [options] <indexName> <rootPath>
+
+Check a tree written by "venn index materialize" against the index it was
+made from, without needing the original files. Every file the index places in
+the tree is re-hashed, so bit rot in old backups shows up as a corrupt file.
+
+Problems are listed with one of these statuses:
+  corrupt              The file's content doesn't match its hash
+  missing              The index has a file or attachment the tree doesn't
+  extra                The file doesn't belong in the tree
+  orphaned_attachment  An attachment whose file is missing, or that the
+                       index doesn't have
+  unreadable           The file couldn't be read
+
+Files that don't belong but are named like a hash are checked against their
+name, and reported as corrupt if they don't match it. The manifest at the
+root of the tree is ignored.
+
+Trees materialized with a layout other than the default must be checked with
+the same --layout.
+
+Exit codes:
+  0  The tree matches the index
+  1  The check couldn't run
+  2  The tree has problems
+
+Arguments:
+  indexName  Name of the index the tree was materialized from
+  rootPath   Root of the materialized tree
+
+Options:
+  --layout L   Layout preset or template the tree was made with (default: hash)
+  --workers N  Files to hash in parallel (default: one per CPU)
+  --format F   Output format: table (default), json, jsonl or csv
+
+Example:
+  venn materialized verify photos /mnt/backup/photos
+  venn materialized verify --layout date --format jsonl photos /mnt/backup/photos
+`
+}
+
+func (c *materializedVerify) Run(args []string) int {
+	var (
+		opts   = core.MaterializedVerifyOptions{Layout: core.HashLayout}
+		format core.OutputFormat
+	)
+	fs := newFlagSet("materialized verify")
+	fs.Var((*layoutValue)(&opts.Layout), "layout", "layout preset or template")
+	fs.IntVar(&opts.Workers, "workers", 0, "number of files to hash in parallel")
+	addFormatFlag(fs, &format)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	rootPath := args[1]
+
+	if err := core.MaterializedVerify(c.logger, c.dbPath, indexName, rootPath, opts, format); err != nil {
+		if errors.Is(err, core.ErrVerifyFailed) {
+			c.logger.Error("materialized tree does not match the index", "index", indexName, "root", rootPath, "error", err)
+			return RunResultProblems
+		}
+		c.logger.Error("failed to verify materialized tree", "index", indexName, "root", rootPath, "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// Prune returns a Command for removing redundant duplicate files.
+func Prune(logger hclog.Logger, dbPath string) Command {
+	return &prune{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type prune struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *prune) Synopsis() string {
+	return "Delete or quarantine redundant duplicate files"
+}
+
+func (c *prune) Help() string {
+	return `Usage: venn prune [options] <indexName>
+
+Remove the redundant copies of each duplicated file in an index, keeping one
+copy chosen by the keeper policy. Redundant copies are either moved into a
+quarantine directory or deleted outright; one of --quarantine or --delete must
+be given.
+
+The keeper and every redundant copy are re-hashed before anything is touched,
+and files that no longer match the index are skipped, so a stale index can't
+cause data loss. If no copy of a file can be verified as a keeper, all of its
+copies are left alone. Removed paths are dropped from the index.
+
+Quarantined files keep their absolute path beneath the quarantine directory,
+and each one is recorded in a manifest that "venn restore-quarantine" can use
+to move them back.
+
+Keeper policies:
+  shortest        Keep the copy with the shortest path (the default)
+  oldest          Keep the copy with the oldest modification time
+  prefix:<path>   Keep a copy under the given path
+  regex:<expr>    Keep a copy whose path matches the regular expression
+
+Ties are broken by sorted path order. With prefix and regex policies, files
+with no matching copy are left alone.
+
+Arguments:
+  indexName  Name of the index whose duplicates should be pruned
+
+Options:
+  --keep P            Keeper policy (see above)
+  --quarantine DIR    Move redundant copies into this directory
+  --manifest FILE     Manifest to append to (default: venn-manifest.jsonl in
+                      the quarantine directory)
+  --delete            Delete redundant copies instead of quarantining them
+  --dry-run           Print what would be removed without changing anything
+
+Example:
+  venn prune --dry-run --delete photos
+  venn prune photos --keep prefix:/mnt/archive --quarantine /mnt/quarantine
+`
+}
+
+func (c *prune) Run(args []string) int {
+	opts := core.PruneOptions{}
+	opts.Keep, _ = core.ParseKeepPolicy("shortest")
+	fs := newFlagSet("prune")
+	fs.Var((*keepPolicyValue)(&opts.Keep), "keep", "keeper policy")
+	fs.StringVar(&opts.Quarantine, "quarantine", "", "directory to move redundant copies into")
+	fs.StringVar(&opts.Manifest, "manifest", "", "quarantine manifest to append to")
+	fs.BoolVar(&opts.Delete, "delete", false, "delete redundant copies")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print what would be removed")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+
+	if err := core.Prune(c.logger, c.dbPath, indexName, opts); err != nil {
+		c.logger.Error("failed to prune index", "index", indexName, "error", err)
+		return 1
+	}
+
+	return 0
+}
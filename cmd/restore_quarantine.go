@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// RestoreQuarantine returns a Command for undoing a quarantining prune.
+func RestoreQuarantine(logger hclog.Logger, dbPath string) Command {
+	return &restoreQuarantine{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type restoreQuarantine struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *restoreQuarantine) Synopsis() string {
+	return "Move quarantined files back to their original paths"
+}
+
+func (c *restoreQuarantine) Help() string {
+	return `Usage: venn restore-quarantine <manifest>
+
+Undo a "venn prune --quarantine" by moving every file recorded in its manifest
+back to its original path, and adding the path back to the index it was
+pruned from.
+
+Files whose original path is occupied again are left in quarantine, so a
+restore never overwrites anything. It's safe to run a restore more than once.
+
+Arguments:
+  manifest  Manifest written by venn prune
+
+Example:
+  venn restore-quarantine /mnt/quarantine/venn-manifest.jsonl
+`
+}
+
+func (c *restoreQuarantine) Run(args []string) int {
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	manifestPath := args[0]
+
+	if err := core.RestoreQuarantine(c.logger, c.dbPath, manifestPath); err != nil {
+		c.logger.Error("failed to restore quarantine", "manifest", manifestPath, "error", err)
+		return 1
+	}
+
+	return 0
+}
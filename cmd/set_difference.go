@@ -6,52 +6,79 @@ import (
 )
 
 // SetDifference returns a Command for computing set difference.
-func SetDifference(logger hclog.Logger) Command {
+func SetDifference(logger hclog.Logger, dbPath string) Command {
 	return &setDifference{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type setDifference struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *setDifference) Synopsis() string {
-	return "Create a new index as A - B"
+	return "Create a new index as A - B - ..."
 }
 
 func (c *setDifference) Help() string {
-	return `Usage: venn set difference <indexName> <indexNameA> <indexNameB>
+	return `Usage: venn set difference [options] <indexName> <indexNameA> <indexNameB> [<indexNameC> ...]
 
-Create a new index containing all files in A that are not in B.
+Create a new index containing all files in A that are not in any of the other
+indexes.
 
 This performs a set difference operation, creating a new index with all entries
-from index A except those that also appear in index B. The operation is based
-on file content (SHA-256 hash), not file paths. Original indexes A and B are
-not modified.
+from index A except those that also appear in index B or any later index. The
+operation is based on file content (SHA-256 hash), not file paths, and is done
+in a single transaction. The input indexes are not modified.
+
+Because the difference is by content, a file is dropped from the result if any
+copy of it is in B, even copies at other paths. With --by-path only the paths
+that B has are removed from each entry, and an entry is only dropped once none
+of its paths are left. This undoes a bad import without losing legitimate
+copies of the same content elsewhere. A path is only removed if B has it with
+the same content, so a file that changed since B was indexed is kept.
 
 Arguments:
   indexName   Name of the new index to create with the result
   indexNameA  First index (files to include)
-  indexNameB  Second index (files to exclude)
+  indexNameB  Indexes with files to exclude, one or more
+
+Options:
+  --by-path  Remove only the paths in the other indexes, not all copies
 
 Example:
   venn set difference cleaned_photos all_photos bad_photos
+  venn set difference to_review all_photos reviewed_2023 reviewed_2024
+  venn set difference --by-path photos_fixed photos bad_import
 `
 }
 
 func (c *setDifference) Run(args []string) int {
-	if len(args) != 3 {
+	var byPath bool
+	fs := newFlagSet("set difference")
+	fs.BoolVar(&byPath, "by-path", false, "remove only the paths in the other indexes")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		c.logger.Error("invalid flags", "error", err)
+		return RunResultHelp
+	}
+
+	if len(args) < 3 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
 	}
 
 	indexName := args[0]
-	indexA := args[1]
-	indexB := args[2]
+	inputs := args[1:]
 
-	if err := core.SetDifference(c.logger, indexName, indexA, indexB); err != nil {
-		c.logger.Error("failed to compute set difference", "result", indexName, "A", indexA, "B", indexB, "error", err)
+	difference := core.SetDifference
+	if byPath {
+		difference = core.SetDifferenceByPath
+	}
+	if err := difference(c.logger, c.dbPath, indexName, inputs...); err != nil {
+		c.logger.Error("failed to compute set difference", "result", indexName, "indexes", inputs, "error", err)
 		return 1
 	}
 
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// SetEval returns a Command for evaluating a set expression.
+func SetEval(logger hclog.Logger, dbPath string) Command {
+	return &setEval{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type setEval struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *setEval) Synopsis() string {
+	return "Create a new index from a set expression"
+}
+
+func (c *setEval) Help() string {
+	return `Usage: venn set eval <indexName> <expression>
+
+Create a new index from an expression combining any number of indexes.
+
+The expression is evaluated in a single transaction without creating any
+intermediate indexes, and the input indexes are not modified. As with the other
+set commands, files are matched by content (SHA-256 hash), and when a file is
+in more than one index its paths and attachments are merged, with the size and
+timestamp coming from the leftmost index.
+
+Operators, which can be written in ASCII or Unicode:
+  A | B   A ∪ B   Union: files in A or B
+  A & B   A ∩ B   Intersection: files in both A and B
+  A - B   A − B   Difference: files in A but not in B
+  A ^ B   A △ B   Symmetric difference: files in A or B but not both
+
+Intersection binds tighter than the other operators, which are evaluated left
+to right, so use parentheses to group anything else. Index names can contain
+letters, digits and any of "_.-:@", and can't start with "-"; quote other names
+with double quotes. Quote the whole expression so the shell doesn't interpret
+it.
+
+Arguments:
+  indexName   Name of the new index to create with the result
+  expression  Set expression over index names
+
+Example:
+  venn set eval keepers '(phone | camera) - (bad_import | trash)'
+  venn set eval only_one 'laptop ^ nas'
+  venn set eval review '"old photos" & camera - reviewed'
+`
+}
+
+func (c *setEval) Run(args []string) int {
+	if len(args) != 2 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	expression := args[1]
+
+	if err := core.SetEval(c.logger, c.dbPath, indexName, expression); err != nil {
+		c.logger.Error("failed to evaluate set expression", "result", indexName, "expression", expression, "error", err)
+		return 1
+	}
+
+	c.logger.Info("set eval completed successfully", "result", indexName)
+	return 0
+}
@@ -6,51 +6,55 @@ import (
 )
 
 // SetIntersection returns a Command for computing set intersection.
-func SetIntersection(logger hclog.Logger) Command {
+func SetIntersection(logger hclog.Logger, dbPath string) Command {
 	return &setIntersection{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type setIntersection struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *setIntersection) Synopsis() string {
-	return "Create a new index as A ∩ B"
+	return "Create a new index as A ∩ B ∩ ..."
 }
 
 func (c *setIntersection) Help() string {
-	return `Usage: venn set intersection <indexName> <indexNameA> <indexNameB>
+	return `Usage: venn set intersection <indexName> <indexNameA> <indexNameB> [<indexNameC> ...]
 
-Create a new index containing only files that appear in both A and B.
+Create a new index containing only files that appear in every input index.
 
 This performs a set intersection operation, creating a new index with only the
-entries that exist in both index A and index B. The operation is based on file
-content (SHA-256 hash), not file paths. Original indexes A and B are not modified.
+entries that exist in all of the input indexes. The operation is based on file
+content (SHA-256 hash), not file paths, and is done in a single transaction.
+Paths and attachments from every input are combined. The input indexes are not
+modified.
 
 Arguments:
   indexName   Name of the new index to create with the result
   indexNameA  First index
-  indexNameB  Second index
+  indexNameB  Other indexes, one or more
 
 Example:
   venn set intersection common_photos photos1 photos2
+  venn set intersection everywhere laptop nas cloud
 `
 }
 
 func (c *setIntersection) Run(args []string) int {
-	if len(args) != 3 {
+	if len(args) < 3 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
 	}
 
 	indexName := args[0]
-	indexA := args[1]
-	indexB := args[2]
+	inputs := args[1:]
 
-	if err := core.SetIntersection(c.logger, indexName, indexA, indexB); err != nil {
-		c.logger.Error("failed to compute set intersection", "result", indexName, "A", indexA, "B", indexB, "error", err)
+	if err := core.SetIntersection(c.logger, c.dbPath, indexName, inputs...); err != nil {
+		c.logger.Error("failed to compute set intersection", "result", indexName, "indexes", inputs, "error", err)
 		return 1
 	}
 
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// SetSymmetricDifference returns a Command for computing set symmetric difference.
+func SetSymmetricDifference(logger hclog.Logger, dbPath string) Command {
+	return &setSymmetricDifference{
+		logger: logger,
+		dbPath: dbPath,
+	}
+}
+
+type setSymmetricDifference struct {
+	logger hclog.Logger
+	dbPath string
+}
+
+func (c *setSymmetricDifference) Synopsis() string {
+	return "Create a new index as A △ B"
+}
+
+func (c *setSymmetricDifference) Help() string {
+	return `Usage: venn set symmetric-difference <indexName> <indexNameA> <indexNameB> [<indexNameC> ...]
+
+Create a new index containing the files that are in only one input index.
+
+This performs a set symmetric difference operation, creating a new index with
+the entries that exist in exactly one of the input indexes, which for two
+indexes is everything unique to either side. The operation is based on file
+content (SHA-256 hash), not file paths, and is done in a single transaction.
+The input indexes are not modified.
+
+With more than two indexes this keeps files found in exactly one of them,
+unlike chaining the ^ operator in "venn set eval", which keeps files found in
+an odd number of them. Use "venn index compare" to see the counts for each side
+without creating an index.
+
+Arguments:
+  indexName   Name of the new index to create with the result
+  indexNameA  First index
+  indexNameB  Other indexes, one or more
+
+Example:
+  venn set symmetric-difference unique_to_one backup_2023 backup_2024
+`
+}
+
+func (c *setSymmetricDifference) Run(args []string) int {
+	if len(args) < 3 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	indexName := args[0]
+	inputs := args[1:]
+
+	if err := core.SetSymmetricDifference(c.logger, c.dbPath, indexName, inputs...); err != nil {
+		c.logger.Error("failed to compute set symmetric difference", "result", indexName, "indexes", inputs, "error", err)
+		return 1
+	}
+
+	c.logger.Info("set symmetric difference completed successfully", "result", indexName)
+	return 0
+}
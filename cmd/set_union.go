@@ -6,51 +6,55 @@ import (
 )
 
 // SetUnion returns a Command for computing set union.
-func SetUnion(logger hclog.Logger) Command {
+func SetUnion(logger hclog.Logger, dbPath string) Command {
 	return &setUnion{
 		logger: logger,
+		dbPath: dbPath,
 	}
 }
 
 type setUnion struct {
 	logger hclog.Logger
+	dbPath string
 }
 
 func (c *setUnion) Synopsis() string {
-	return "Create a new index as A ∪ B"
+	return "Create a new index as A ∪ B ∪ ..."
 }
 
 func (c *setUnion) Help() string {
-	return `Usage: venn set union <indexName> <indexNameA> <indexNameB>
+	return `Usage: venn set union <indexName> <indexNameA> <indexNameB> [<indexNameC> ...]
 
-Create a new index containing all files from both A and B.
+Create a new index containing all files from every input index.
 
 This performs a set union operation, creating a new index with all entries from
-both index A and index B. When a file appears in both indexes (same SHA-256 hash),
-all paths and metadata are merged. Original indexes A and B are not modified.
+all of the input indexes in a single transaction. When a file appears in more
+than one index (same SHA-256 hash), all paths and attachments are merged, and
+the size and timestamp come from the first index that has it. The input indexes
+are not modified.
 
 Arguments:
   indexName   Name of the new index to create with the result
   indexNameA  First index
-  indexNameB  Second index
+  indexNameB  Other indexes, one or more
 
 Example:
   venn set union all_photos photos1 photos2
+  venn set union all_cards card01 card02 card03 card04
 `
 }
 
 func (c *setUnion) Run(args []string) int {
-	if len(args) != 3 {
+	if len(args) < 3 {
 		c.logger.Error("incorrect number of arguments")
 		return RunResultHelp
 	}
 
 	indexName := args[0]
-	indexA := args[1]
-	indexB := args[2]
+	inputs := args[1:]
 
-	if err := core.SetUnion(c.logger, indexName, indexA, indexB); err != nil {
-		c.logger.Error("failed to compute set union", "result", indexName, "A", indexA, "B", indexB, "error", err)
+	if err := core.SetUnion(c.logger, c.dbPath, indexName, inputs...); err != nil {
+		c.logger.Error("failed to compute set union", "result", indexName, "indexes", inputs, "error", err)
 		return 1
 	}
 
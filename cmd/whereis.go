@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/slackpad/venn/core"
+)
+
+// Whereis returns a Command for finding where a materialized file came from.
+func Whereis(logger hclog.Logger) Command {
+	return &whereis{
+		logger: logger,
+	}
+}
+
+type whereis struct {
+	logger hclog.Logger
+}
+
+func (c *whereis) Synopsis() string {
+	return "Show where a materialized file came from"
+}
+
+func (c *whereis) Help() string {
+	return `Usage: venn whereis <path>
+
+Show the original paths of a file in a materialized tree.
+
+Every "venn index materialize" writes a manifest named .venn-manifest.jsonl at
+the root of the tree, mapping each file to its index, hash, the source path it
+was placed from, the other paths with the same content, and the timestamp it
+was given. This command finds the manifest by looking in the file's folder and
+each folder above it, so it works from anywhere in the tree. Attachments are
+shown along with the file they belong to.
+
+The manifest is plain JSON Lines, so it can also be searched with tools such
+as grep or jq.
+
+Arguments:
+  path  Path to a materialized file
+
+Example:
+  venn whereis /backup/photos/3a/7f/3a7f09c1....jpg
+`
+}
+
+func (c *whereis) Run(args []string) int {
+	if len(args) != 1 {
+		c.logger.Error("incorrect number of arguments")
+		return RunResultHelp
+	}
+
+	path := args[0]
+
+	if err := core.Whereis(c.logger, path); err != nil {
+		c.logger.Error("failed to look up file", "path", path, "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/hashicorp/go-hclog"
+)
+
+// zstdCommand is the external compressor used for .tar.zst archives, since
+// the standard library has no zstd encoder.
+const zstdCommand = "zstd"
+
+// archiveWriter adds files to an archive being streamed out.
+type archiveWriter interface {
+	// add writes a file with the given name, size and timestamp, reading
+	// exactly size bytes from r.
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	close() error
+}
+
+// tarArchive writes a tar archive, optionally through a compressor.
+type tarArchive struct {
+	tw *tar.Writer
+
+	// compressor is the running zstd process, if any, and stdin is the pipe
+	// the tar stream is written to.
+	compressor *exec.Cmd
+	stdin      io.WriteCloser
+}
+
+func (a *tarArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     materializedFileMode,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.Copy(a.tw, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("file is %d bytes, expected %d", n, size)
+	}
+	return nil
+}
+
+func (a *tarArchive) close() error {
+	err := a.tw.Close()
+	if a.compressor == nil {
+		return err
+	}
+	if closeErr := a.stdin.Close(); err == nil {
+		err = closeErr
+	}
+	if waitErr := a.compressor.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("%s failed: %w", zstdCommand, waitErr)
+	}
+	return err
+}
+
+// zipArchive writes a zip archive.
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	hdr.SetMode(materializedFileMode)
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("file is %d bytes, expected %d", n, size)
+	}
+	return nil
+}
+
+func (a *zipArchive) close() error {
+	return a.zw.Close()
+}
+
+// newArchiveWriter starts an archive of the kind named by the archive path's
+// extension, writing it to out.
+func newArchiveWriter(archivePath string, out *os.File) (archiveWriter, error) {
+	name := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return &tarArchive{tw: tar.NewWriter(out)}, nil
+	case strings.HasSuffix(name, ".zip"):
+		return &zipArchive{zw: zip.NewWriter(out)}, nil
+	case strings.HasSuffix(name, ".tar.zst"):
+		if _, err := exec.LookPath(zstdCommand); err != nil {
+			return nil, fmt.Errorf(".tar.zst archives need the %s command on the PATH: %w", zstdCommand, err)
+		}
+		cmd := exec.Command(zstdCommand, "-q", "-c")
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start %s: %w", zstdCommand, err)
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start %s: %w", zstdCommand, err)
+		}
+		return &tarArchive{tw: tar.NewWriter(stdin), compressor: cmd, stdin: stdin}, nil
+	}
+	return nil, fmt.Errorf("unknown archive type for %q (want .tar, .zip or .tar.zst)", archivePath)
+}
+
+// MaterializeArchive writes a materialized view of an index into a tar, zip
+// or zstd-compressed tar archive, using the same layout, attachment and
+// timestamp rules as Materialize. Files are hashed as they are streamed, and
+// the archive is written through a temporary file that only replaces
+// archivePath once every file has been verified.
+func MaterializeArchive(logger hclog.Logger, dbPath, indexName, archivePath string, opts MaterializeOptions) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if archivePath == "" {
+		return errors.New("archive path cannot be empty")
+	}
+	if opts.Link != "" && opts.Link != LinkCopy {
+		return fmt.Errorf("archives can't use %s mode", opts.Link)
+	}
+	if opts.Resume {
+		return errors.New("archives can't be resumed")
+	}
+	if opts.Workers != 0 {
+		return errors.New("archives are written in order, so can't use workers")
+	}
+	if opts.Sync || opts.DryRun {
+		return errors.New("archives are always written in full, so can't be synced")
+	}
+	if opts.Layout.parts == nil {
+		opts.Layout = HashLayout
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	items, err := planMaterialize(db, indexName, opts.Layout)
+	db.Close()
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(archivePath), ".venn-tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	// Ensure cleanup on error
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpName)
+		}
+	}()
+
+	aw, err := newArchiveWriter(archivePath, tmpFile)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := writeArchive(logger, aw, indexName, items, opts); err != nil {
+		aw.close()
+		tmpFile.Close()
+		return err
+	}
+
+	if err := aw.close(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmpName, archivePath); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+
+	success = true
+	fmt.Printf("%d files archived to %s\n", len(items), archivePath)
+	return nil
+}
+
+// writeArchive streams every planned item, its attachments and finally the
+// manifest into an archive.
+func writeArchive(logger hclog.Logger, aw archiveWriter, indexName string, items []*materializeItem, opts MaterializeOptions) error {
+	bar := pb.StartNew(len(items))
+	defer bar.Finish()
+
+	for _, item := range items {
+		bar.Increment()
+
+		name := filepath.ToSlash(item.dst)
+		if err := addFileToArchive(aw, name, item.src, item.hash, item.entry.Timestamp, opts.NoVerify); err != nil {
+			return fmt.Errorf("failed to archive %q as %q: %w", item.src, name, err)
+		}
+		logger.Debug("archived file", "source", item.src, "name", name)
+
+		for attachExt, attachSrc := range item.entry.Attachments {
+			attachName := filepath.ToSlash(attachmentPath(item.dst, attachExt))
+			if err := addFileToArchive(aw, attachName, attachSrc, nil, item.entry.Timestamp, true); err != nil {
+				return fmt.Errorf("failed to archive attachment %q as %q: %w", attachSrc, attachName, err)
+			}
+		}
+	}
+
+	var manifest bytes.Buffer
+	if err := encodeManifest(&manifest, indexName, items, nil); err != nil {
+		return err
+	}
+	return aw.add(materializeManifestName, int64(manifest.Len()), time.Now(), &manifest)
+}
+
+// addFileToArchive streams a file into an archive, checking it against its
+// hash as it goes unless noVerify is set. A zero timestamp uses the file's
+// own modification time.
+func addFileToArchive(aw archiveWriter, name, src string, hash []byte, timestamp time.Time, noVerify bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+	if timestamp.IsZero() {
+		timestamp = info.ModTime()
+	}
+
+	h := sha256.New()
+	if err := aw.add(name, info.Size(), timestamp, io.TeeReader(in, h)); err != nil {
+		return err
+	}
+
+	// The archive is thrown away on a mismatch, so nothing stale escapes
+	if !noVerify && !bytes.Equal(hash, h.Sum(nil)) {
+		return errors.New("hash mismatch: index is stale")
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// setupArchiveIndex indexes one file with a .json attachment and returns the
+// file's path and the names it should have in an archive.
+func setupArchiveIndex(t *testing.T, dbPath string, tmpDir string, timestamp time.Time) (string, map[string]string) {
+	t.Helper()
+
+	content := []byte("photo content")
+	filePath := filepath.Join(tmpDir, "photo.jpg")
+	attachment := filepath.Join(tmpDir, "photo.jpg.json")
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(attachment, []byte(`{"title":"photo"}`), 0644); err != nil {
+		t.Fatalf("failed to create attachment: %v", err)
+	}
+
+	hash := sha256.Sum256(content)
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	createTestIndex(t, db, "test-index", map[string]*indexEntry{
+		string(hash[:]): {
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{".json": attachment},
+			Size:        int64(len(content)),
+			Timestamp:   timestamp,
+		},
+	})
+
+	hexHash := hex.EncodeToString(hash[:])
+	dir := hexHash[0:2] + "/" + hexHash[2:4] + "/"
+	return filePath, map[string]string{
+		dir + hexHash + ".jpg":  string(content),
+		dir + hexHash + ".json": `{"title":"photo"}`,
+		materializeManifestName: "",
+	}
+}
+
+// readTar returns the contents and timestamps of every file in a tar stream.
+func readTar(t *testing.T, r io.Reader) (map[string]string, map[string]time.Time) {
+	t.Helper()
+
+	files := make(map[string]string)
+	times := make(map[string]time.Time)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read tar entry: %v", err)
+		}
+		files[hdr.Name] = string(data)
+		times[hdr.Name] = hdr.ModTime
+	}
+	return files, times
+}
+
+func TestMaterializeArchive(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	timestamp := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	_, want := setupArchiveIndex(t, dbPath, tmpDir, timestamp)
+	logger := hclog.NewNullLogger()
+
+	checkFiles := func(t *testing.T, files map[string]string, times map[string]time.Time) {
+		t.Helper()
+		if len(files) != len(want) {
+			t.Errorf("archive has %d files, want %d: %v", len(files), len(want), files)
+		}
+		for name, content := range want {
+			got, ok := files[name]
+			if !ok {
+				t.Errorf("archive is missing %s", name)
+				continue
+			}
+			if content != "" && got != content {
+				t.Errorf("%s = %q, want %q", name, got, content)
+			}
+			// Attachments take the file's timestamp, as in a folder
+			if name != materializeManifestName && !times[name].Equal(timestamp) {
+				t.Errorf("%s timestamp = %v, want %v", name, times[name], timestamp)
+			}
+		}
+	}
+
+	t.Run("folder", func(t *testing.T) {
+		outputDir := filepath.Join(tmpDir, "output")
+		if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+			t.Fatalf("Materialize() error = %v", err)
+		}
+		files := make(map[string]string)
+		times := make(map[string]time.Time)
+		for name := range want {
+			p := filepath.Join(outputDir, filepath.FromSlash(name))
+			data, err := os.ReadFile(p)
+			if err != nil {
+				continue
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				t.Fatalf("failed to stat %s: %v", name, err)
+			}
+			files[name] = string(data)
+			times[name] = info.ModTime()
+		}
+		checkFiles(t, files, times)
+	})
+
+	t.Run("tar", func(t *testing.T) {
+		archive := filepath.Join(tmpDir, "out.tar")
+		if err := MaterializeArchive(logger, dbPath, "test-index", archive, MaterializeOptions{}); err != nil {
+			t.Fatalf("MaterializeArchive() error = %v", err)
+		}
+		f, err := os.Open(archive)
+		if err != nil {
+			t.Fatalf("failed to open archive: %v", err)
+		}
+		defer f.Close()
+		files, times := readTar(t, f)
+		checkFiles(t, files, times)
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		archive := filepath.Join(tmpDir, "out.zip")
+		if err := MaterializeArchive(logger, dbPath, "test-index", archive, MaterializeOptions{}); err != nil {
+			t.Fatalf("MaterializeArchive() error = %v", err)
+		}
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			t.Fatalf("failed to open archive: %v", err)
+		}
+		defer zr.Close()
+		files := make(map[string]string)
+		times := make(map[string]time.Time)
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("failed to open zip entry: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(data)
+			times[f.Name] = f.Modified
+		}
+		checkFiles(t, files, times)
+	})
+
+	t.Run("tar.zst", func(t *testing.T) {
+		if _, err := exec.LookPath(zstdCommand); err != nil {
+			t.Skip("zstd is not installed")
+		}
+		archive := filepath.Join(tmpDir, "out.tar.zst")
+		if err := MaterializeArchive(logger, dbPath, "test-index", archive, MaterializeOptions{}); err != nil {
+			t.Fatalf("MaterializeArchive() error = %v", err)
+		}
+		data, err := exec.Command(zstdCommand, "-q", "-d", "-c", archive).Output()
+		if err != nil {
+			t.Fatalf("failed to decompress archive: %v", err)
+		}
+		files, times := readTar(t, bytes.NewReader(data))
+		checkFiles(t, files, times)
+	})
+}
+
+func TestMaterializeArchive_Errors(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	filePath, _ := setupArchiveIndex(t, dbPath, tmpDir, time.Now())
+	logger := hclog.NewNullLogger()
+
+	if err := MaterializeArchive(logger, dbPath, "test-index", filepath.Join(tmpDir, "out.rar"), MaterializeOptions{}); err == nil {
+		t.Error("MaterializeArchive() with an unknown type should fail")
+	}
+	if err := MaterializeArchive(logger, dbPath, "test-index", filepath.Join(tmpDir, "out.tar"), MaterializeOptions{Link: LinkHardlink}); err == nil {
+		t.Error("MaterializeArchive() with links should fail")
+	}
+	if err := MaterializeArchive(logger, dbPath, "test-index", filepath.Join(tmpDir, "out.tar"), MaterializeOptions{Workers: 4}); err == nil {
+		t.Error("MaterializeArchive() with workers should fail")
+	}
+
+	// A stale source leaves nothing behind
+	if err := os.WriteFile(filePath, []byte("edited since indexing"), 0644); err != nil {
+		t.Fatalf("failed to edit test file: %v", err)
+	}
+	archive := filepath.Join(tmpDir, "stale.tar")
+	if err := MaterializeArchive(logger, dbPath, "test-index", archive, MaterializeOptions{}); err == nil {
+		t.Error("MaterializeArchive() with a stale source should fail")
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("stale archive was written: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmpDir, ".venn-tmp-*")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
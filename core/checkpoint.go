@@ -0,0 +1,81 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// startCheckpoint prepares the materialize checkpoint for an index and root,
+// which is kept with the index. When resuming, it returns the hashes the last
+// run finished, mapped to their destinations; otherwise any old checkpoint is
+// discarded so the run starts fresh.
+func startCheckpoint(db *bolt.DB, indexName, absRoot string, resume bool) (map[string]string, error) {
+	finished := make(map[string]string)
+	err := db.Update(func(tx *bolt.Tx) error {
+		checkpoints, err := getBucketForIndex(tx, indexName, checkpointsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		key := []byte(absRoot)
+		if !resume {
+			if err := checkpoints.DeleteBucket(key); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return fmt.Errorf("failed to delete checkpoint: %w", err)
+			}
+			return nil
+		}
+
+		bucket := checkpoints.Bucket(key)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(hash, dst []byte) error {
+			finished[string(hash)] = string(dst)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return finished, nil
+}
+
+// updateCheckpoint records finished items in the checkpoint for a root.
+func updateCheckpoint(db *bolt.DB, indexName, absRoot string, items []*materializeItem) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		checkpoints, err := getBucketForIndex(tx, indexName, checkpointsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		bucket, err := checkpoints.CreateBucketIfNotExists([]byte(absRoot))
+		if err != nil {
+			return fmt.Errorf("failed to create checkpoint: %w", err)
+		}
+
+		for _, item := range items {
+			if err := bucket.Put(item.hash, []byte(item.dst)); err != nil {
+				return fmt.Errorf("failed to update checkpoint: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// clearCheckpoint removes the checkpoint for a root once a run completes.
+func clearCheckpoint(db *bolt.DB, indexName, absRoot string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		checkpoints, err := getBucketForIndex(tx, indexName, checkpointsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		err = checkpoints.DeleteBucket([]byte(absRoot))
+		if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return fmt.Errorf("failed to delete checkpoint: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/ryanuber/columnize"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Groups that index compare sorts hashes into.
+const (
+	CompareOnlyA = "only_a"
+	CompareOnlyB = "only_b"
+	CompareBoth  = "both"
+)
+
+// CompareOptions controls which groups index compare lists, in addition to
+// counting them.
+type CompareOptions struct {
+	ListOnlyA bool
+	ListOnlyB bool
+	ListBoth  bool
+}
+
+// compareCounts is the size of one group of a comparison.
+type compareCounts struct {
+	Hashes int   `json:"hashes"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// compareSummary is the JSON representation of a comparison.
+type compareSummary struct {
+	IndexA string        `json:"index_a"`
+	IndexB string        `json:"index_b"`
+	OnlyA  compareCounts `json:"only_a"`
+	OnlyB  compareCounts `json:"only_b"`
+	Both   compareCounts `json:"both"`
+}
+
+// compareEntryJSON is the JSON representation of a listed entry.
+type compareEntryJSON struct {
+	Group string `json:"group"`
+	entryJSON
+}
+
+// IndexCompare compares two indexes by content, like a diff of two backups.
+// It counts the hashes and bytes only in A, only in B and in both, and can
+// list the entries in each group. Listed entries in both indexes have their
+// paths from both merged. Without any listings the counts are printed in the
+// given format; with listings the entries are, followed by the counts for the
+// table format.
+func IndexCompare(logger hclog.Logger, dbPath, indexA, indexB string, opts CompareOptions, format OutputFormat) error {
+	if indexA == "" {
+		return errors.New("index A name cannot be empty")
+	}
+	if indexB == "" {
+		return errors.New("index B name cannot be empty")
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		bucketA, err := getBucketForIndex(tx, indexA, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		bucketB, err := getBucketForIndex(tx, indexB, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		listing := opts.ListOnlyA || opts.ListOnlyB || opts.ListBoth
+		var out *recordWriter
+		if listing {
+			header := []string{"Group", "SHA-256", "Bytes", "Path(s)"}
+			if format == FormatCSV {
+				header = []string{"group", "sha256", "size", "path"}
+			}
+			if out, err = newRecordWriter(os.Stdout, format, header); err != nil {
+				return err
+			}
+		}
+
+		summary, err := compareIndexes(bucketA, bucketB, opts, func(group string, hash []byte, entry *indexEntry) error {
+			return out.write(compareEntryJSON{group, newEntryJSON(hash, entry)}, compareRows(format, group, hash, entry)...)
+		})
+		if err != nil {
+			return err
+		}
+		summary.IndexA, summary.IndexB = indexA, indexB
+
+		if listing {
+			if err := out.close(); err != nil {
+				return err
+			}
+			if format != FormatTable {
+				return nil
+			}
+			fmt.Println()
+		}
+		return writeCompareSummary(format, summary)
+	})
+}
+
+// compareIndexes walks two hashes buckets with walkByMembership, like the set
+// operations, and counts the hashes only in a, only in b and in both, calling
+// list for each entry in a group that opts asks for. Entries in both have the
+// paths from b merged in.
+func compareIndexes(a, b *bolt.Bucket, opts CompareOptions, list func(group string, hash []byte, entry *indexEntry) error) (compareSummary, error) {
+	var summary compareSummary
+	walks := []struct {
+		group      string
+		src, other *bolt.Bucket
+		inOther    bool
+		list       bool
+		counts     *compareCounts
+	}{
+		{CompareOnlyA, a, b, false, opts.ListOnlyA, &summary.OnlyA},
+		{CompareOnlyB, b, a, false, opts.ListOnlyB, &summary.OnlyB},
+		{CompareBoth, a, b, true, opts.ListBoth, &summary.Both},
+	}
+	for _, w := range walks {
+		err := walkByMembership(w.src, []*bolt.Bucket{w.other}, w.inOther, func(hash, entryData []byte) error {
+			entry, err := decodeEntry(entryData)
+			if err != nil {
+				return fmt.Errorf("failed to decode entry: %w", err)
+			}
+			w.counts.Hashes++
+			w.counts.Bytes += entry.Size
+			if !w.list {
+				return nil
+			}
+
+			if w.inOther {
+				otherEntry, err := getEntry(w.other, hash)
+				if err != nil {
+					return fmt.Errorf("failed to get entry: %w", err)
+				}
+				entry.merge(otherEntry)
+			}
+			return list(w.group, hash, entry)
+		})
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// compareRows returns the table and CSV rows for a listed entry, with one row
+// per path for CSV like entryRows.
+func compareRows(format OutputFormat, group string, hash []byte, entry *indexEntry) [][]string {
+	paths := sortedPaths(entry)
+	fields := []string{group, fmt.Sprintf("%x", hash), strconv.FormatInt(entry.Size, 10)}
+	if format == FormatTable {
+		return [][]string{append(fields, strings.Join(paths, ","))}
+	}
+
+	rows := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		rows = append(rows, append(append([]string{}, fields...), p))
+	}
+	return rows
+}
+
+// writeCompareSummary prints the counts of a comparison.
+func writeCompareSummary(format OutputFormat, summary compareSummary) error {
+	switch format {
+	case FormatJSON, FormatJSONL:
+		return writeJSON(os.Stdout, format, summary)
+
+	case FormatCSV:
+		out, err := newRecordWriter(os.Stdout, format, []string{"group", "hashes", "bytes"})
+		if err != nil {
+			return err
+		}
+		for _, g := range []struct {
+			group  string
+			counts compareCounts
+		}{
+			{CompareOnlyA, summary.OnlyA},
+			{CompareOnlyB, summary.OnlyB},
+			{CompareBoth, summary.Both},
+		} {
+			row := []string{g.group, strconv.Itoa(g.counts.Hashes), strconv.FormatInt(g.counts.Bytes, 10)}
+			if err := out.write(nil, row); err != nil {
+				return err
+			}
+		}
+		return out.close()
+	}
+
+	rows := []string{
+		"Group|Hashes|Bytes",
+		fmt.Sprintf("Only in %s|%d|%d", summary.IndexA, summary.OnlyA.Hashes, summary.OnlyA.Bytes),
+		fmt.Sprintf("Only in %s|%d|%d", summary.IndexB, summary.OnlyB.Hashes, summary.OnlyB.Bytes),
+		fmt.Sprintf("In both|%d|%d", summary.Both.Hashes, summary.Both.Bytes),
+	}
+	fmt.Println(columnize.SimpleFormat(rows))
+	return nil
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIndexCompare(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	entry := func(path string, size int64) *indexEntry {
+		return &indexEntry{
+			Paths:       map[string]struct{}{path: {}},
+			Attachments: map[string]string{},
+			Size:        size,
+			Timestamp:   time.Now(),
+		}
+	}
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "old", map[string]*indexEntry{
+			"gone":   entry("old/gone", 10),
+			"shared": entry("old/shared", 100),
+		})
+		createTestIndex(t, db, "new", map[string]*indexEntry{
+			"added1": entry("new/added1", 1),
+			"added2": entry("new/added2", 2),
+			"shared": entry("new/shared", 100),
+		})
+	}()
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	var (
+		summary compareSummary
+		listed  = make(map[string][]string)
+		paths   int
+	)
+	err = db.View(func(tx *bolt.Tx) error {
+		a, err := getBucketForIndex(tx, "old", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		b, err := getBucketForIndex(tx, "new", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		opts := CompareOptions{ListOnlyB: true, ListBoth: true}
+		summary, err = compareIndexes(a, b, opts, func(group string, hash []byte, entry *indexEntry) error {
+			listed[group] = append(listed[group], string(hash))
+			if group == CompareBoth {
+				paths = len(entry.Paths)
+			}
+			return nil
+		})
+		return err
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("compareIndexes() error = %v", err)
+	}
+
+	want := compareSummary{
+		OnlyA: compareCounts{Hashes: 1, Bytes: 10},
+		OnlyB: compareCounts{Hashes: 2, Bytes: 3},
+		Both:  compareCounts{Hashes: 1, Bytes: 100},
+	}
+	if summary != want {
+		t.Errorf("compareIndexes() = %+v, want %+v", summary, want)
+	}
+	if len(listed[CompareOnlyA]) != 0 {
+		t.Errorf("listed only_a = %v, want none", listed[CompareOnlyA])
+	}
+	if len(listed[CompareOnlyB]) != 2 || len(listed[CompareBoth]) != 1 {
+		t.Errorf("listed = %v, want 2 only_b and 1 both", listed)
+	}
+	if paths != 2 {
+		t.Errorf("shared entry has %d paths, want 2 merged", paths)
+	}
+
+	logger := hclog.NewNullLogger()
+	for _, format := range []OutputFormat{FormatTable, FormatJSON, FormatJSONL, FormatCSV} {
+		if err := IndexCompare(logger, dbPath, "old", "new", CompareOptions{}, format); err != nil {
+			t.Errorf("IndexCompare(%s) error = %v", format, err)
+		}
+		if err := IndexCompare(logger, dbPath, "old", "new", CompareOptions{ListOnlyA: true}, format); err != nil {
+			t.Errorf("IndexCompare(%s) with listing error = %v", format, err)
+		}
+	}
+
+	if err := IndexCompare(logger, dbPath, "old", "missing", CompareOptions{}, FormatTable); err == nil {
+		t.Error("expected error for a missing index")
+	}
+	if err := IndexCompare(logger, dbPath, "", "new", CompareOptions{}, FormatTable); err == nil {
+		t.Error("expected error for an empty index name")
+	}
+}
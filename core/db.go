@@ -13,12 +13,19 @@ import (
 )
 
 const (
-	dbPath           = "venn.db"
 	dbFileMode       = 0600 // Read/write for owner only
 	indexesBucketKey = "INDEXES"
 	hashesBucketKey  = "HASHES"
+	pathsBucketKey   = "PATHS"
+
+	// checkpointsBucketKey holds one bucket per materialize root, mapping
+	// each finished hash to its destination.
+	checkpointsBucketKey = "CHECKPOINTS"
 )
 
+// DefaultDBPath is the venn database used when no other path is given.
+const DefaultDBPath = "venn.db"
+
 var (
 	// ErrNotInitialized indicates that the venn database has not been initialized
 	ErrNotInitialized = errors.New("venn has not been initialized")
@@ -59,8 +66,35 @@ func (entry *indexEntry) merge(other *indexEntry) {
 	}
 }
 
-// CreateDB creates a new venn database file.
-func CreateDB(logger hclog.Logger) error {
+// pathEntry records the state of a scanned file and the hash it had at that
+// time, so unchanged files can be skipped when an index is re-scanned.
+type pathEntry struct {
+	Size    int64
+	ModTime time.Time
+	Inode   uint64
+	Hash    []byte
+}
+
+// newPathEntry returns the path entry for a file with the given hash.
+func newPathEntry(info os.FileInfo, hash []byte) *pathEntry {
+	return &pathEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Inode:   fileInode(info),
+		Hash:    hash,
+	}
+}
+
+// unchanged reports whether the file described by info still matches the
+// recorded size, modification time and inode.
+func (p *pathEntry) unchanged(info os.FileInfo) bool {
+	return p.Size == info.Size() &&
+		p.ModTime.Equal(info.ModTime()) &&
+		p.Inode == fileInode(info)
+}
+
+// CreateDB creates a new venn database file at dbPath.
+func CreateDB(logger hclog.Logger, dbPath string) error {
 	if _, err := os.Stat(dbPath); err == nil {
 		return ErrAlreadyInitialized
 	}
@@ -76,8 +110,8 @@ func CreateDB(logger hclog.Logger) error {
 	return nil
 }
 
-// getDB opens and returns the venn database.
-func getDB() (*bolt.DB, error) {
+// getDB opens and returns the venn database at dbPath.
+func getDB(dbPath string) (*bolt.DB, error) {
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		return nil, ErrNotInitialized
 	}
@@ -218,6 +252,31 @@ func putEntry(b *bolt.Bucket, hash []byte, entry *indexEntry) error {
 	return nil
 }
 
+// removePath removes a path from the entry with the given hash, deleting the
+// entry once it has no paths left. It is not an error if the entry or the path
+// is already gone.
+func removePath(b *bolt.Bucket, hash []byte, path string) error {
+	entry, err := getEntry(b, hash)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	if _, ok := entry.Paths[path]; !ok {
+		return nil
+	}
+
+	delete(entry.Paths, path)
+	if len(entry.Paths) == 0 {
+		if err := b.Delete(hash); err != nil {
+			return fmt.Errorf("failed to delete entry: %w", err)
+		}
+		return nil
+	}
+	return putEntry(b, hash, entry)
+}
+
 // decodeEntry decodes a byte slice into an indexEntry.
 func decodeEntry(v []byte) (*indexEntry, error) {
 	if len(v) == 0 {
@@ -231,3 +290,46 @@ func decodeEntry(v []byte) (*indexEntry, error) {
 	}
 	return &entry, nil
 }
+
+// getPathEntry retrieves the path entry for a file path from the bucket.
+func getPathEntry(b *bolt.Bucket, path string) (*pathEntry, error) {
+	if b == nil {
+		return nil, errors.New("bucket cannot be nil")
+	}
+	if path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	v := b.Get([]byte(path))
+	if v == nil {
+		return nil, nil
+	}
+
+	var entry pathEntry
+	if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("failed to decode path entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// putPathEntry stores the path entry for a file path in the bucket.
+func putPathEntry(b *bolt.Bucket, path string, entry *pathEntry) error {
+	if b == nil {
+		return errors.New("bucket cannot be nil")
+	}
+	if path == "" {
+		return errors.New("path cannot be empty")
+	}
+	if entry == nil {
+		return errors.New("entry cannot be nil")
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return fmt.Errorf("failed to encode path entry: %w", err)
+	}
+	if err := b.Put([]byte(path), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to put path entry: %w", err)
+	}
+	return nil
+}
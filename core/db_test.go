@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -150,12 +151,12 @@ func TestDecodeEntry_Errors(t *testing.T) {
 }
 
 func TestCreateDB(t *testing.T) {
-	t.Chdir(t.TempDir())
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 
 	logger := hclog.NewNullLogger()
 
 	// Create database
-	err := CreateDB(logger)
+	err := CreateDB(logger, dbPath)
 	if err != nil {
 		t.Fatalf("CreateDB() error = %v", err)
 	}
@@ -167,43 +168,43 @@ func TestCreateDB(t *testing.T) {
 }
 
 func TestCreateDB_AlreadyInitialized(t *testing.T) {
-	t.Chdir(t.TempDir())
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 
 	logger := hclog.NewNullLogger()
 
 	// First init creates the database.
-	if err := CreateDB(logger); err != nil {
+	if err := CreateDB(logger, dbPath); err != nil {
 		t.Fatalf("CreateDB() first call error = %v", err)
 	}
 
 	// Second init must refuse rather than silently reopen the existing file.
-	err := CreateDB(logger)
+	err := CreateDB(logger, dbPath)
 	if !errors.Is(err, ErrAlreadyInitialized) {
 		t.Errorf("CreateDB() second call error = %v, want %v", err, ErrAlreadyInitialized)
 	}
 }
 
 func TestGetDB_NotInitialized(t *testing.T) {
-	// A fresh working directory has no venn.db.
-	t.Chdir(t.TempDir())
+	// A fresh directory has no venn.db.
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 
-	_, err := getDB()
+	_, err := getDB(dbPath)
 	if err != ErrNotInitialized {
 		t.Errorf("getDB() error = %v, want %v", err, ErrNotInitialized)
 	}
 }
 
 func TestBucketOperations(t *testing.T) {
-	t.Chdir(t.TempDir())
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 
 	// Create a test database
 	logger := hclog.NewNullLogger()
-	err := CreateDB(logger)
+	err := CreateDB(logger, dbPath)
 	if err != nil {
 		t.Fatalf("CreateDB() error = %v", err)
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		t.Fatalf("getDB() error = %v", err)
 	}
@@ -248,16 +249,16 @@ func TestBucketOperations(t *testing.T) {
 }
 
 func TestDeleteBucketForIndex(t *testing.T) {
-	t.Chdir(t.TempDir())
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 
 	// Create a test database
 	logger := hclog.NewNullLogger()
-	err := CreateDB(logger)
+	err := CreateDB(logger, dbPath)
 	if err != nil {
 		t.Fatalf("CreateDB() error = %v", err)
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		t.Fatalf("getDB() error = %v", err)
 	}
@@ -363,3 +364,87 @@ func TestPutEntry_Errors(t *testing.T) {
 		})
 	}
 }
+
+func TestPathEntry(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(filePath, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "test-index", pathsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		missing, err := getPathEntry(bucket, filePath)
+		if err != nil {
+			return err
+		}
+		if missing != nil {
+			t.Errorf("getPathEntry() = %v, want nil before put", missing)
+		}
+
+		if err := putPathEntry(bucket, filePath, newPathEntry(info, []byte("hash"))); err != nil {
+			return err
+		}
+
+		got, err := getPathEntry(bucket, filePath)
+		if err != nil {
+			return err
+		}
+		if string(got.Hash) != "hash" {
+			t.Errorf("Hash = %q, want %q", got.Hash, "hash")
+		}
+		if !got.unchanged(info) {
+			t.Error("unchanged() = false for the same file info")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction error = %v", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte("longer content"), 0644); err != nil {
+		t.Fatalf("failed to rewrite test file: %v", err)
+	}
+	changed, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+	if newPathEntry(info, nil).unchanged(changed) {
+		t.Error("unchanged() = true after the file grew")
+	}
+}
+
+func TestCreateDB_OtherPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	dbPath := filepath.Join(t.TempDir(), "other.db")
+	logger := hclog.NewNullLogger()
+	if err := CreateDB(logger, dbPath); err != nil {
+		t.Fatalf("CreateDB() error = %v", err)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("database not created at %s: %v", dbPath, err)
+	}
+	if _, err := os.Stat(DefaultDBPath); err == nil {
+		t.Error("database created in the working directory")
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("getDB() error = %v", err)
+	}
+	db.Close()
+
+	if _, err := getDB(DefaultDBPath); err != ErrNotInitialized {
+		t.Errorf("getDB() of the default path error = %v, want %v", err, ErrNotInitialized)
+	}
+}
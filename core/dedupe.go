@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// DedupeOptions controls how duplicate files are replaced with links.
+type DedupeOptions struct {
+	// Mode is the kind of link that replaces each redundant copy.
+	Mode LinkMode
+
+	// DryRun prints what would be linked without changing any files.
+	DryRun bool
+}
+
+// dedupeSummary counts the outcome of a dedupe run.
+type dedupeSummary struct {
+	linked    int
+	skipped   int
+	reclaimed int64
+}
+
+// Dedupe replaces redundant copies of each duplicated file in an index with
+// links to one canonical copy. Every file is re-hashed before it is touched,
+// and files are only linked to a canonical copy on the same filesystem, so
+// each filesystem keeps one real copy of the content. The index itself is not
+// changed since every path keeps the same content.
+func Dedupe(logger hclog.Logger, dbPath, indexName string, opts DedupeOptions) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if _, err := ParseLinkMode(string(opts.Mode)); err != nil {
+		return err
+	}
+	if opts.Mode == LinkCopy {
+		return errors.New("copy mode can't reclaim any space")
+	}
+
+	dupes, err := loadDuplicates(dbPath, indexName, DupesOptions{Sort: DupesSortHash})
+	if err != nil {
+		return err
+	}
+
+	var summary dedupeSummary
+	for _, d := range dupes {
+		dedupeEntry(logger, d, opts, &summary)
+	}
+
+	verb := "linked"
+	if opts.DryRun {
+		verb = "would be linked"
+	}
+	fmt.Printf("%d files %s (%d bytes reclaimed), %d skipped\n",
+		summary.linked, verb, summary.reclaimed, summary.skipped)
+	return nil
+}
+
+// linkCandidate is a verified copy of a duplicated file.
+type linkCandidate struct {
+	path string
+	info os.FileInfo
+}
+
+// dedupeEntry links the copies of one duplicated entry, grouped by
+// filesystem. Problems with individual files are logged and skipped.
+func dedupeEntry(logger hclog.Logger, d duplicate, opts DedupeOptions, summary *dedupeSummary) {
+	// The first verified copy on each filesystem becomes its canonical copy
+	canonical := make(map[uint64]linkCandidate)
+	for _, p := range sortedPaths(d.entry) {
+		info, err := os.Lstat(p)
+		if err != nil {
+			logger.Warn("skipping unreadable file", "path", p, "error", err)
+			summary.skipped++
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			logger.Debug("skipping file that is not a regular file", "path", p)
+			continue
+		}
+
+		// Without a filesystem ID a link could be planned across filesystems
+		dev, known := fileDevice(info)
+		if !known {
+			logger.Warn("skipping file on an unknown filesystem", "path", p)
+			summary.skipped++
+			continue
+		}
+		keeper, ok := canonical[dev]
+		if ok && os.SameFile(keeper.info, info) {
+			logger.Debug("skipping file that is already linked", "path", p, "canonical", keeper.path)
+			continue
+		}
+
+		hash, err := hashFile(p)
+		if err != nil {
+			logger.Warn("skipping unreadable file", "path", p, "error", err)
+			summary.skipped++
+			continue
+		}
+		if !bytes.Equal(hash, d.hash) {
+			logger.Warn("skipping file that no longer matches the index", "path", p)
+			summary.skipped++
+			continue
+		}
+
+		if !ok {
+			canonical[dev] = linkCandidate{path: p, info: info}
+			continue
+		}
+
+		if opts.DryRun {
+			fmt.Printf("%s %s -> %s\n", opts.Mode, p, keeper.path)
+		} else {
+			if err := linkFile(opts.Mode, keeper.path, p); err != nil {
+				logger.Warn("failed to link file", "path", p, "canonical", keeper.path, "error", err)
+				summary.skipped++
+				continue
+			}
+			if opts.Mode == LinkReflink {
+				restoreFileInfo(logger, p, info)
+			}
+			logger.Debug("linked file", "mode", opts.Mode, "path", p, "canonical", keeper.path)
+		}
+		summary.linked++
+		summary.reclaimed += info.Size()
+	}
+}
+
+// restoreFileInfo puts back the permissions and modification time a file had
+// before it was replaced by a clone.
+func restoreFileInfo(logger hclog.Logger, path string, info os.FileInfo) {
+	if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+		logger.Warn("failed to restore permissions", "path", path, "error", err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		logger.Warn("failed to restore modification time", "path", path, "error", err)
+	}
+}
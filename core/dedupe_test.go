@@ -0,0 +1,111 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// writeDuplicates creates the named files with the same content and indexes
+// the folder holding them.
+func writeDuplicates(t *testing.T, dbPath string, indexName string, names ...string) string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	for _, name := range names {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, []byte("duplicated content"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, indexName, tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+	return tmpDir
+}
+
+func TestDedupe_Hardlink(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	tmpDir := writeDuplicates(t, dbPath, "test-index", "a.txt", "b.txt", "c.txt")
+
+	// Make one copy stale, so it must be skipped rather than replaced
+	stale := filepath.Join(tmpDir, "c.txt")
+	if err := os.WriteFile(stale, []byte("edited since indexing"), 0644); err != nil {
+		t.Fatalf("failed to edit test file: %v", err)
+	}
+
+	logger := hclog.NewNullLogger()
+	if err := Dedupe(logger, dbPath, "test-index", DedupeOptions{Mode: LinkHardlink}); err != nil {
+		t.Fatalf("Dedupe() error = %v", err)
+	}
+
+	a, _ := os.Stat(filepath.Join(tmpDir, "a.txt"))
+	b, _ := os.Stat(filepath.Join(tmpDir, "b.txt"))
+	c, _ := os.Stat(stale)
+	if !os.SameFile(a, b) {
+		t.Error("b.txt was not linked to a.txt")
+	}
+	if os.SameFile(a, c) {
+		t.Error("stale c.txt was linked")
+	}
+	if got, _ := os.ReadFile(stale); string(got) != "edited since indexing" {
+		t.Errorf("stale file content = %q, want it untouched", got)
+	}
+
+	// A second run finds everything already linked
+	if err := Dedupe(logger, dbPath, "test-index", DedupeOptions{Mode: LinkHardlink}); err != nil {
+		t.Fatalf("second Dedupe() error = %v", err)
+	}
+}
+
+func TestDedupe_DryRun(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	tmpDir := writeDuplicates(t, dbPath, "test-index", "a.txt", "b.txt")
+
+	logger := hclog.NewNullLogger()
+	if err := Dedupe(logger, dbPath, "test-index", DedupeOptions{Mode: LinkSymlink, DryRun: true}); err != nil {
+		t.Fatalf("Dedupe() error = %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join(tmpDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		t.Error("dry run replaced b.txt")
+	}
+}
+
+func TestDedupe_Symlink(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	tmpDir := writeDuplicates(t, dbPath, "test-index", "a.txt", "b.txt")
+
+	logger := hclog.NewNullLogger()
+	if err := Dedupe(logger, dbPath, "test-index", DedupeOptions{Mode: LinkSymlink}); err != nil {
+		t.Fatalf("Dedupe() error = %v", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(tmpDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("b.txt is not a symlink: %v", err)
+	}
+	if target != filepath.Join(tmpDir, "a.txt") {
+		t.Errorf("b.txt links to %q, want a.txt", target)
+	}
+}
+
+func TestDedupe_Errors(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	logger := hclog.NewNullLogger()
+
+	if err := Dedupe(logger, dbPath, "", DedupeOptions{Mode: LinkHardlink}); err == nil {
+		t.Error("Dedupe() expected error for empty index name")
+	}
+	if err := Dedupe(logger, dbPath, "test-index", DedupeOptions{Mode: "copy"}); err == nil {
+		t.Error("Dedupe() expected error for unsupported mode")
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Duplicate report sort orders.
+const (
+	// DupesSortWasted sorts by wasted bytes, largest first.
+	DupesSortWasted = "wasted"
+	// DupesSortCount sorts by number of copies, most first.
+	DupesSortCount = "count"
+	// DupesSortHash sorts by hash, which is the index order.
+	DupesSortHash = "hash"
+)
+
+// DupesOptions controls the duplicate report.
+type DupesOptions struct {
+	// MinSize skips files smaller than this many bytes.
+	MinSize int64
+
+	// Top limits the report to the first N duplicates after sorting. Zero
+	// means no limit.
+	Top int
+
+	// Sort is one of the DupesSort orders; empty means DupesSortWasted.
+	Sort string
+}
+
+// duplicate is an index entry with more than one path.
+type duplicate struct {
+	hash  []byte
+	entry *indexEntry
+}
+
+// wasted returns the bytes used by the redundant copies.
+func (d duplicate) wasted() int64 {
+	return d.entry.Size * int64(len(d.entry.Paths)-1)
+}
+
+// duplicateJSON is the JSON representation of a duplicate.
+type duplicateJSON struct {
+	entryJSON
+	Copies      int   `json:"copies"`
+	WastedBytes int64 `json:"wasted_bytes"`
+}
+
+// IndexDupes reports every hash in an index that has more than one path.
+func IndexDupes(logger hclog.Logger, dbPath, indexName string, opts DupesOptions, format OutputFormat) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+
+	dupes, err := loadDuplicates(dbPath, indexName, opts)
+	if err != nil {
+		return err
+	}
+
+	header := []string{"SHA-256", "Bytes", "Copies", "Wasted", "Path(s)"}
+	if format == FormatCSV {
+		header = []string{"sha256", "size", "copies", "wasted_bytes", "path"}
+	}
+	out, err := newRecordWriter(os.Stdout, format, header)
+	if err != nil {
+		return err
+	}
+
+	var totalWasted int64
+	for _, d := range dupes {
+		totalWasted += d.wasted()
+
+		paths := sortedPaths(d.entry)
+		fields := []string{
+			fmt.Sprintf("%x", d.hash),
+			strconv.FormatInt(d.entry.Size, 10),
+			strconv.Itoa(len(paths)),
+			strconv.FormatInt(d.wasted(), 10),
+		}
+		var rows [][]string
+		if format == FormatTable {
+			rows = append(rows, append(fields, strings.Join(paths, ",")))
+		} else {
+			for _, p := range paths {
+				rows = append(rows, append(append([]string{}, fields...), p))
+			}
+		}
+
+		object := duplicateJSON{
+			entryJSON:   newEntryJSON(d.hash, d.entry),
+			Copies:      len(paths),
+			WastedBytes: d.wasted(),
+		}
+		if err := out.write(object, rows...); err != nil {
+			return err
+		}
+	}
+	if err := out.close(); err != nil {
+		return err
+	}
+
+	if format == FormatTable {
+		fmt.Println()
+		fmt.Printf("%d duplicated hashes; %d bytes wasted\n", len(dupes), totalWasted)
+	}
+	return nil
+}
+
+// loadDuplicates reads the duplicates of an index and closes the database, so
+// slow file operations don't hold it open.
+func loadDuplicates(dbPath, indexName string, opts DupesOptions) ([]duplicate, error) {
+	db, err := getDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var dupes []duplicate
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		dupes, err = findDuplicates(bucket, opts)
+		return err
+	})
+	return dupes, err
+}
+
+// findDuplicates returns the entries in the bucket with more than one path,
+// filtered, sorted and limited according to opts.
+func findDuplicates(bucket *bolt.Bucket, opts DupesOptions) ([]duplicate, error) {
+	if opts.MinSize < 0 {
+		return nil, errors.New("minimum size cannot be negative")
+	}
+	if opts.Top < 0 {
+		return nil, errors.New("top cannot be negative")
+	}
+
+	var less func(a, b duplicate) bool
+	switch opts.Sort {
+	case "", DupesSortWasted:
+		less = func(a, b duplicate) bool { return a.wasted() > b.wasted() }
+	case DupesSortCount:
+		less = func(a, b duplicate) bool { return len(a.entry.Paths) > len(b.entry.Paths) }
+	case DupesSortHash:
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", opts.Sort)
+	}
+
+	var dupes []duplicate
+	cursor := bucket.Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		entry, err := decodeEntry(entryData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		if len(entry.Paths) < 2 || entry.Size < opts.MinSize {
+			continue
+		}
+		dupes = append(dupes, duplicate{hash: bytes.Clone(hash), entry: entry})
+	}
+
+	// The cursor returns hashes in order, so a stable sort keeps ties in hash
+	// order
+	if less != nil {
+		sort.SliceStable(dupes, func(i, j int) bool { return less(dupes[i], dupes[j]) })
+	}
+	if opts.Top > 0 && len(dupes) > opts.Top {
+		dupes = dupes[:opts.Top]
+	}
+	return dupes, nil
+}
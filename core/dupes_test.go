@@ -0,0 +1,95 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	entry := func(size int64, paths ...string) *indexEntry {
+		e := &indexEntry{
+			Paths:       make(map[string]struct{}),
+			Attachments: map[string]string{},
+			Size:        size,
+			Timestamp:   time.Now(),
+			ContentType: "text/plain",
+		}
+		for _, p := range paths {
+			e.Paths[p] = struct{}{}
+		}
+		return e
+	}
+	createTestIndex(t, db, "test-index", map[string]*indexEntry{
+		"hash1": entry(100, "a"),                  // unique
+		"hash2": entry(10, "b1", "b2", "b3"),      // wastes 20
+		"hash3": entry(1000, "c1", "c2"),          // wastes 1000
+		"hash4": entry(50, "d1", "d2"),            // wastes 50
+		"hash5": entry(5, "e1", "e2", "e3", "e4"), // wastes 15
+	})
+
+	tests := []struct {
+		name    string
+		opts    DupesOptions
+		want    []string
+		wantErr bool
+	}{
+		{"default sort", DupesOptions{}, []string{"hash3", "hash4", "hash2", "hash5"}, false},
+		{"by count", DupesOptions{Sort: DupesSortCount}, []string{"hash5", "hash2", "hash3", "hash4"}, false},
+		{"by hash", DupesOptions{Sort: DupesSortHash}, []string{"hash2", "hash3", "hash4", "hash5"}, false},
+		{"min size", DupesOptions{MinSize: 10}, []string{"hash3", "hash4", "hash2"}, false},
+		{"top", DupesOptions{Top: 2}, []string{"hash3", "hash4"}, false},
+		{"bad sort", DupesOptions{Sort: "bogus"}, nil, true},
+		{"negative top", DupesOptions{Top: -1}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.View(func(tx *bolt.Tx) error {
+				bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
+				if err != nil {
+					return err
+				}
+
+				dupes, err := findDuplicates(bucket, tt.opts)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("findDuplicates() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				var got []string
+				for _, d := range dupes {
+					got = append(got, string(d.hash))
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("findDuplicates() = %v, want %v", got, tt.want)
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("findDuplicates() = %v, want %v", got, tt.want)
+						break
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("transaction error = %v", err)
+			}
+		})
+	}
+}
+
+func TestIndexDupes_Errors(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	logger := hclog.NewNullLogger()
+
+	if err := IndexDupes(logger, dbPath, "", DupesOptions{}, FormatTable); err == nil {
+		t.Error("IndexDupes() expected error for empty index name")
+	}
+	if err := IndexDupes(logger, dbPath, "missing", DupesOptions{}, FormatTable); err == nil {
+		t.Error("IndexDupes() expected error for missing index")
+	}
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ignoreFileName is the name of the optional file in a scan root that lists
+// exclude patterns, one per line.
+const ignoreFileName = ".vennignore"
+
+// globPattern is a gitignore-style glob. Patterns without a slash match a name
+// at any depth, patterns with a slash are anchored to the scan root, "**"
+// matches any number of directories, and a trailing slash only matches
+// directories.
+type globPattern struct {
+	segments []string
+	dirOnly  bool
+}
+
+// parseGlobPattern parses a gitignore-style glob.
+func parseGlobPattern(pattern string) (globPattern, error) {
+	p := strings.TrimSpace(pattern)
+	if p == "" {
+		return globPattern{}, errors.New("pattern cannot be empty")
+	}
+
+	var g globPattern
+	if strings.HasSuffix(p, "/") {
+		g.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+
+	// Without a slash the pattern may match at any level
+	if !strings.Contains(p, "/") {
+		p = "**/" + p
+	}
+	p = strings.TrimPrefix(p, "/")
+
+	g.segments = strings.Split(p, "/")
+	for _, s := range g.segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return globPattern{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return g, nil
+}
+
+// match reports whether the slash-separated path relative to the scan root
+// matches the pattern.
+func (g globPattern) match(rel string, isDir bool) bool {
+	if g.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(g.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches pattern segments against path segments, letting "**"
+// stand for zero or more path segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// sizeUnits maps the suffixes accepted by ParseSize to their multipliers.
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a byte count with an optional unit suffix such as "512",
+// "10KB" or "1.5 GB". Units are powers of 1024 and are case insensitive.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	scale := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			scale = u.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// pathFilter decides which files under a scan root are indexed. A nil filter
+// accepts everything.
+type pathFilter struct {
+	root    string
+	include []globPattern
+	exclude []globPattern
+
+	// minSize and maxSize bound file sizes; a zero maxSize means no limit.
+	minSize int64
+	maxSize int64
+
+	// contentTypes are prefixes, one of which the detected content type must
+	// start with.
+	contentTypes []string
+}
+
+// newPathFilter builds a filter for a scan root from the options, adding any
+// exclude patterns listed in the root's .vennignore file.
+func newPathFilter(root string, opts IndexAddOptions) (*pathFilter, error) {
+	if opts.MinSize < 0 || opts.MaxSize < 0 {
+		return nil, errors.New("size limits cannot be negative")
+	}
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return nil, errors.New("minimum size cannot be larger than maximum size")
+	}
+
+	f := &pathFilter{
+		root:         root,
+		minSize:      opts.MinSize,
+		maxSize:      opts.MaxSize,
+		contentTypes: opts.ContentTypes,
+	}
+	for _, p := range opts.Include {
+		g, err := parseGlobPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, g)
+	}
+
+	ignored, err := readIgnoreFile(filepath.Join(root, ignoreFileName))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range append(opts.Exclude, ignored...) {
+		g, err := parseGlobPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, g)
+	}
+	return f, nil
+}
+
+// readIgnoreFile returns the patterns in an ignore file, skipping blank lines
+// and comments. A missing file has no patterns.
+func readIgnoreFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return patterns, nil
+}
+
+// accept reports whether a path found while walking the scan root should be
+// visited. Directories are only checked against the exclude patterns, so an
+// include pattern like "*.jpg" still descends into every folder.
+func (f *pathFilter) accept(p string, info os.FileInfo) bool {
+	if f == nil {
+		return true
+	}
+
+	rel, err := filepath.Rel(f.root, p)
+	if err != nil || rel == "." {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+
+	if !info.IsDir() && rel == ignoreFileName {
+		return false
+	}
+
+	for _, g := range f.exclude {
+		if g.match(rel, info.IsDir()) {
+			return false
+		}
+	}
+	if info.IsDir() {
+		return true
+	}
+
+	if info.Size() < f.minSize || (f.maxSize > 0 && info.Size() > f.maxSize) {
+		return false
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, g := range f.include {
+		if g.match(rel, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptContent reports whether a file's detected content type starts with one
+// of the filter's content type prefixes. The file is only opened when there
+// are prefixes to check.
+func (f *pathFilter) acceptContent(logger hclog.Logger, path string, info os.FileInfo) (bool, error) {
+	if f == nil || len(f.contentTypes) == 0 {
+		return true, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	contentType, err := detectContentType(logger, file, info)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect content type: %w", err)
+	}
+
+	for _, prefix := range f.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// walkFiles calls fn for every non-directory under rootPath accepted by the
+// filter, skipping excluded directories entirely.
+func walkFiles(rootPath string, filter *pathFilter, fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(rootPath,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("walk error at %q: %w", path, err)
+			}
+
+			if !filter.accept(path, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+			return fn(path, info)
+		})
+}
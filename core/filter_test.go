@@ -0,0 +1,223 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestGlobPattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{".DS_Store", ".DS_Store", false, true},
+		{".DS_Store", "a/b/.DS_Store", false, true},
+		{"*.tmp", "a/file.tmp", false, true},
+		{"*.tmp", "a/file.tmp.jpg", false, false},
+		{"@eaDir/", "photos/@eaDir", true, true},
+		{"@eaDir/", "photos/@eaDir", false, false},
+		{"/top.txt", "top.txt", false, true},
+		{"/top.txt", "a/top.txt", false, false},
+		{"a/*.jpg", "a/x.jpg", false, true},
+		{"a/*.jpg", "b/a/x.jpg", false, false},
+		{"**/DCIM/**", "card/DCIM/100/x.jpg", false, true},
+		{"**/DCIM/**", "card/Other/x.jpg", false, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+	}
+
+	for _, tt := range tests {
+		g, err := parseGlobPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseGlobPattern(%q) error = %v", tt.pattern, err)
+		}
+		if got := g.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q.match(%q, %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestParseGlobPattern_Errors(t *testing.T) {
+	for _, p := range []string{"", "  ", "[unclosed"} {
+		if _, err := parseGlobPattern(p); err == nil {
+			t.Errorf("parseGlobPattern(%q) expected error", p)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	files := []string{
+		"a.jpg",
+		"b.png",
+		"notes.txt",
+		".DS_Store",
+		"@eaDir/a.jpg",
+		".git/config",
+		"sub/c.jpg",
+		"sub/Thumbs.db",
+	}
+	for _, file := range files {
+		filePath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(file), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	ignore := "# Synology thumbnails\n@eaDir/\n\nThumbs.db\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ignoreFileName), []byte(ignore), 0644); err != nil {
+		t.Fatalf("failed to create ignore file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    int
+	}{
+		{"ignore file only", nil, nil, 6},
+		{"exclude", nil, []string{".DS_Store", ".git/"}, 4},
+		{"include", []string{"*.jpg"}, nil, 2},
+		{"include and exclude", []string{"*.jpg", "*.png"}, []string{"sub/"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newPathFilter(tmpDir, IndexAddOptions{Include: tt.include, Exclude: tt.exclude})
+			if err != nil {
+				t.Fatalf("newPathFilter() error = %v", err)
+			}
+
+			count, err := countFiles(logger, tmpDir, filter)
+			if err != nil {
+				t.Fatalf("countFiles() error = %v", err)
+			}
+			if count != tt.want {
+				t.Errorf("countFiles() = %v, want %v", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexAddFiles_Filters(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	for _, file := range []string{"keep.jpg", "skip.txt", "@eaDir/thumb.jpg"} {
+		filePath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(file), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	logger := hclog.NewNullLogger()
+	opts := IndexAddOptions{Include: []string{"*.jpg"}, Exclude: []string{"@eaDir/"}}
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, opts); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if got := entryCount(t, db, "test-index"); got != 1 {
+		t.Errorf("indexed %d files, want 1", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"10KB", 10 << 10, false},
+		{"10 kb", 10 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"2GiB", 2 << 30, false},
+		{"1TB", 1 << 40, false},
+		{"7B", 7, false},
+		{"", 0, true},
+		{"big", 0, true},
+		{"-1KB", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIndexAddFiles_SizeAndContentType(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	html := "<!DOCTYPE html><html><body>" + strings.Repeat("x", 600) + "</body></html>"
+	files := map[string]string{
+		"tiny.html":  "<html></html>",
+		"page.html":  html,
+		"blob.bin":   strings.Repeat("\x00", 700),
+		"large.html": html + strings.Repeat(" ", 2000),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	logger := hclog.NewNullLogger()
+	opts := IndexAddOptions{MinSize: 100, MaxSize: 1000, ContentTypes: []string{"text/"}}
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, opts); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if got := entryCount(t, db, "test-index"); got != 1 {
+		t.Errorf("indexed %d files, want only page.html", got)
+	}
+}
+
+func TestNewPathFilter_Errors(t *testing.T) {
+	tests := []IndexAddOptions{
+		{MinSize: -1},
+		{MaxSize: -1},
+		{MinSize: 10, MaxSize: 5},
+		{Include: []string{"[bad"}},
+	}
+
+	for _, opts := range tests {
+		if _, err := newPathFilter(t.TempDir(), opts); err == nil {
+			t.Errorf("newPathFilter(%+v) expected error", opts)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/hashicorp/go-hclog"
@@ -23,83 +26,352 @@ const (
 	defaultContentType = "application/octet-stream"
 	// minSizeForContentDetection is the minimum file size needed for content type detection
 	minSizeForContentDetection = 512
+	// indexBatchSize is the number of hashed files written per database transaction
+	indexBatchSize = 1000
 )
 
+// IndexAddOptions controls how files are added to an index.
+type IndexAddOptions struct {
+	// Workers is the number of files hashed in parallel. Zero or less uses
+	// one worker per CPU.
+	Workers int
+
+	// Rehash hashes every file, even ones whose size, modification time and
+	// inode match the previous scan.
+	Rehash bool
+
+	// Include and Exclude are gitignore-style glob patterns matched against
+	// paths relative to the scan root. When Include is given, only files
+	// matching one of its patterns are indexed. Excluded directories are
+	// skipped entirely. Patterns from a .vennignore file in the scan root are
+	// added to Exclude.
+	Include []string
+	Exclude []string
+
+	// MinSize and MaxSize skip files smaller or larger than the given number
+	// of bytes before they are hashed. A zero MaxSize means no limit.
+	MinSize int64
+	MaxSize int64
+
+	// ContentTypes only indexes files whose detected content type starts
+	// with one of the given prefixes, such as "image/".
+	ContentTypes []string
+}
+
 // IndexAddFiles indexes all files in the given root path.
-func IndexAddFiles(logger hclog.Logger, indexName, rootPath string) error {
-	return indexAdd(logger, indexFile, indexName, rootPath)
+func IndexAddFiles(logger hclog.Logger, dbPath, indexName, rootPath string, opts IndexAddOptions) error {
+	_, err := indexAdd(logger, dbPath, indexFile, indexName, rootPath, opts)
+	return err
 }
 
 // IndexAddGooglePhotosTakeout indexes files from a Google Photos takeout, preserving timestamps from metadata.
-func IndexAddGooglePhotosTakeout(logger hclog.Logger, indexName, rootPath string) error {
-	return indexAdd(logger, indexGooglePhotosTakeout, indexName, rootPath)
+func IndexAddGooglePhotosTakeout(logger hclog.Logger, dbPath, indexName, rootPath string, opts IndexAddOptions) error {
+	_, err := indexAdd(logger, dbPath, indexGooglePhotosTakeout, indexName, rootPath, opts)
+	return err
+}
+
+// indexedFile is the result of indexing a single file, ready to be written to
+// the index bucket.
+type indexedFile struct {
+	hash  []byte
+	entry *indexEntry
+
+	// path and info describe the scanned file; they are filled in by the
+	// pipeline rather than the indexFn.
+	path string
+	info os.FileInfo
+
+	// metadataTimestamp is set when entry.Timestamp came from a metadata file
+	// and should replace the timestamp of an existing entry.
+	metadataTimestamp bool
 }
 
-// indexFn is a function type for indexing a file.
-type indexFn func(logger hclog.Logger, b *bolt.Bucket, path string, info os.FileInfo) error
+// indexFn is a function type for indexing a file. It does the expensive work
+// of hashing the file and runs concurrently, so it must not touch the
+// database. A nil result means the file should be skipped.
+type indexFn func(logger hclog.Logger, path string, info os.FileInfo) (*indexedFile, error)
+
+// pathChanges counts how the paths in an index changed during a scan.
+type pathChanges struct {
+	added   int
+	changed int
+	removed int
+}
+
+// indexJob is a file found by the walker that still needs to be indexed.
+type indexJob struct {
+	path string
+	info os.FileInfo
+}
 
-// indexAdd adds files to an index using the provided indexing function.
-func indexAdd(logger hclog.Logger, fn indexFn, indexName, rootPath string) error {
+// indexAdd adds files to an index using the provided indexing function. Files
+// are hashed by a pool of workers and written to the database in batches by a
+// single writer, so a failure part way through leaves the batches that were
+// already written in the index. Files that are unchanged since they were last
+// added to the index are skipped unless opts.Rehash is set.
+func indexAdd(logger hclog.Logger, dbPath string, fn indexFn, indexName, rootPath string, opts IndexAddOptions) (*pathChanges, error) {
 	if indexName == "" {
-		return errors.New("index name cannot be empty")
+		return nil, errors.New("index name cannot be empty")
 	}
 	if rootPath == "" {
-		return errors.New("root path cannot be empty")
+		return nil, errors.New("root path cannot be empty")
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
-	count, err := countFiles(logger, rootPath)
+	filter, err := newPathFilter(rootPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := countFiles(logger, rootPath, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	// Make sure both buckets exist so workers can read them
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := getBucketForIndex(tx, indexName, hashesBucketKey); err != nil {
+			return err
+		}
+		_, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to count files: %w", err)
+		return nil, err
 	}
 
 	bar := pb.StartNew(count)
 	defer bar.Finish()
 
-	return db.Update(func(tx *bolt.Tx) error {
-		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// Walk the tree, feeding files to the workers
+	jobs := make(chan indexJob, workers)
+	go func() {
+		defer close(jobs)
+		err := walkFiles(rootPath, filter,
+			func(path string, info os.FileInfo) error {
+				select {
+				case jobs <- indexJob{path: path, info: info}:
+					return nil
+				case <-ctx.Done():
+					return context.Cause(ctx)
+				}
+			})
 		if err != nil {
-			return err
+			cancel(err)
 		}
+	}()
+
+	// Hash files in parallel
+	results := make(chan *indexedFile, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if !opts.Rehash {
+					unchanged, err := isUnchanged(db, indexName, job.path, job.info)
+					if err != nil {
+						cancel(fmt.Errorf("failed to check %q: %w", job.path, err))
+						return
+					}
+					if unchanged {
+						logger.Debug("skipping unchanged file", "path", job.path)
+						bar.Increment()
+						continue
+					}
+				}
 
-		return filepath.Walk(rootPath,
-			func(path string, info os.FileInfo, err error) error {
+				accepted, err := filter.acceptContent(logger, job.path, job.info)
 				if err != nil {
-					return fmt.Errorf("walk error at %q: %w", path, err)
+					cancel(fmt.Errorf("failed to check %q: %w", job.path, err))
+					return
 				}
-
-				if info.IsDir() {
-					return nil
+				if !accepted {
+					logger.Debug("skipping file with unwanted content type", "path", job.path)
+					bar.Increment()
+					continue
 				}
 
-				if err := fn(logger, bucket, path, info); err != nil {
-					return fmt.Errorf("failed to index %q: %w", path, err)
+				result, err := fn(logger, job.path, job.info)
+				if err != nil {
+					cancel(fmt.Errorf("failed to index %q: %w", job.path, err))
+					return
 				}
 
 				bar.Increment()
-				return nil
-			})
-	})
-}
+				if result == nil {
+					continue
+				}
+				result.path = job.path
+				result.info = job.info
 
-// countFiles counts the number of files in the given root path.
-func countFiles(logger hclog.Logger, rootPath string) (int, error) {
-	count := 0
-	err := filepath.Walk(rootPath,
-		func(path string, info os.FileInfo, err error) error {
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Write results in batches from this goroutine only
+	changes := &pathChanges{}
+	batch := make([]*indexedFile, 0, indexBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+			if err != nil {
+				return err
+			}
+
+			pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
 			if err != nil {
-				return fmt.Errorf("walk error at %q: %w", path, err)
+				return err
 			}
 
-			if info.IsDir() {
-				return nil
+			for _, result := range batch {
+				if err := putIndexedFile(bucket, pathsBucket, result, changes); err != nil {
+					return err
+				}
 			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+
+	for result := range results {
+		if ctx.Err() != nil {
+			continue // drain so the workers can exit
+		}
 
+		batch = append(batch, result)
+		if len(batch) < indexBatchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			cancel(err)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// isUnchanged reports whether a file was already added to the index and its
+// size, modification time and inode have not changed since. Each call uses a
+// short read transaction so the writer is never blocked for long.
+func isUnchanged(db *bolt.DB, indexName, path string, info os.FileInfo) (bool, error) {
+	unchanged := false
+	err := db.View(func(tx *bolt.Tx) error {
+		pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		recorded, err := getPathEntry(pathsBucket, path)
+		if err != nil {
+			return err
+		}
+		if recorded == nil || !recorded.unchanged(info) {
+			return nil
+		}
+
+		// Only trust the recorded hash if its entry still lists this path
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		entry, err := getEntry(bucket, recorded.Hash)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			_, unchanged = entry.Paths[path]
+		}
+		return nil
+	})
+	return unchanged, err
+}
+
+// putIndexedFile merges an indexed file into the bucket, combining it with any
+// existing entry for the same hash, and records the file's state in the paths
+// bucket. If the path was previously recorded under a different hash, it is
+// moved off the old entry. The outcome is counted in changes.
+func putIndexedFile(bucket, pathsBucket *bolt.Bucket, result *indexedFile, changes *pathChanges) error {
+	previous, err := getPathEntry(pathsBucket, result.path)
+	if err != nil {
+		return fmt.Errorf("failed to get previous path entry: %w", err)
+	}
+
+	moved := previous != nil && !bytes.Equal(previous.Hash, result.hash)
+	if moved {
+		if err := removePath(bucket, previous.Hash, result.path); err != nil {
+			return err
+		}
+	}
+
+	entry, err := getEntry(bucket, result.hash)
+	if err != nil {
+		return fmt.Errorf("failed to get existing entry: %w", err)
+	}
+
+	listed := false
+	if entry == nil {
+		entry = result.entry
+	} else {
+		_, listed = entry.Paths[result.path]
+		entry.merge(result.entry)
+		if result.metadataTimestamp {
+			entry.Timestamp = result.entry.Timestamp
+		}
+	}
+
+	switch {
+	case moved:
+		changes.changed++
+	case !listed:
+		changes.added++
+	}
+
+	if err := putEntry(bucket, result.hash, entry); err != nil {
+		return err
+	}
+	return putPathEntry(pathsBucket, result.path, newPathEntry(result.info, result.hash))
+}
+
+// countFiles counts the number of files in the given root path that pass the
+// filter.
+func countFiles(logger hclog.Logger, rootPath string, filter *pathFilter) (int, error) {
+	count := 0
+	err := walkFiles(rootPath, filter,
+		func(path string, info os.FileInfo) error {
 			count++
 			return nil
 		})
@@ -110,7 +382,7 @@ func countFiles(logger hclog.Logger, rootPath string) (int, error) {
 }
 
 // makeFileEntry creates an index entry for a file, computing its hash and metadata.
-func makeFileEntry(logger hclog.Logger, bucket *bolt.Bucket, path string, info os.FileInfo) ([]byte, *indexEntry, error) {
+func makeFileEntry(logger hclog.Logger, path string, info os.FileInfo) ([]byte, *indexEntry, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open file: %w", err)
@@ -124,31 +396,34 @@ func makeFileEntry(logger hclog.Logger, bucket *bolt.Bucket, path string, info o
 	}
 	hash := h.Sum(nil)
 
-	// Check if entry already exists
-	entry, err := getEntry(bucket, hash)
+	contentType, err := detectContentType(logger, f, info)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get existing entry: %w", err)
+		return nil, nil, fmt.Errorf("failed to detect content type: %w", err)
 	}
 
-	// Create new entry if it doesn't exist
-	if entry == nil {
-		contentType, err := detectContentType(logger, f, info)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to detect content type: %w", err)
-		}
+	entry := &indexEntry{
+		Paths:       map[string]struct{}{path: {}},
+		Attachments: make(map[string]string),
+		Size:        info.Size(),
+		Timestamp:   info.ModTime(),
+		ContentType: contentType,
+	}
+	return hash, entry, nil
+}
 
-		entry = &indexEntry{
-			Paths:       make(map[string]struct{}),
-			Attachments: make(map[string]string),
-			Size:        info.Size(),
-			Timestamp:   info.ModTime(),
-			ContentType: contentType,
-		}
+// hashFile computes the SHA-256 hash of a file's content.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer f.Close()
 
-	// Add this path to the entry
-	entry.Paths[path] = struct{}{}
-	return hash, entry, nil
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+	return h.Sum(nil), nil
 }
 
 // detectContentType detects the MIME type of a file.
@@ -177,55 +452,59 @@ func detectContentType(logger hclog.Logger, f *os.File, info os.FileInfo) (strin
 }
 
 // indexFile indexes a regular file.
-func indexFile(logger hclog.Logger, bucket *bolt.Bucket, path string, info os.FileInfo) error {
-	hash, entry, err := makeFileEntry(logger, bucket, path, info)
+func indexFile(logger hclog.Logger, path string, info os.FileInfo) (*indexedFile, error) {
+	hash, entry, err := makeFileEntry(logger, path, info)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return putEntry(bucket, hash, entry)
+	return &indexedFile{hash: hash, entry: entry}, nil
 }
 
-// indexGooglePhotosTakeout indexes a file from Google Photos takeout, handling metadata files.
-func indexGooglePhotosTakeout(logger hclog.Logger, bucket *bolt.Bucket, path string, info os.FileInfo) error {
-	const metadataExt = ".json"
+// takeoutMetadataExt is the extension of the metadata file that a Google
+// Photos takeout puts next to each photo.
+const takeoutMetadataExt = ".json"
 
+// indexGooglePhotosTakeout indexes a file from Google Photos takeout, handling metadata files.
+func indexGooglePhotosTakeout(logger hclog.Logger, path string, info os.FileInfo) (*indexedFile, error) {
 	// Skip metadata files that have a companion content file
 	// (they will be processed with the main file)
-	if strings.HasSuffix(path, metadataExt) {
-		base := strings.TrimSuffix(path, metadataExt)
+	if strings.HasSuffix(path, takeoutMetadataExt) {
+		base := strings.TrimSuffix(path, takeoutMetadataExt)
 		if _, err := os.Stat(base); err == nil {
 			logger.Debug("skipping metadata file with companion", "path", path, "companion", base)
-			return nil
+			return nil, nil
 		}
 	}
 
-	hash, entry, err := makeFileEntry(logger, bucket, path, info)
+	hash, entry, err := makeFileEntry(logger, path, info)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	result := &indexedFile{hash: hash, entry: entry}
 
 	// Check for metadata file and extract timestamp
-	metadataPath := path + metadataExt
+	metadataPath := path + takeoutMetadataExt
 	if _, err := os.Stat(metadataPath); err == nil {
 		timestamp, err := getTakeoutTimestamp(metadataPath)
 		if err != nil {
 			logger.Warn("failed to extract timestamp from metadata", "metadata", metadataPath, "error", err)
 		} else {
 			entry.Timestamp = timestamp
-			entry.Attachments[metadataExt] = metadataPath
+			entry.Attachments[takeoutMetadataExt] = metadataPath
+			result.metadataTimestamp = true
 		}
 	}
 
-	return putEntry(bucket, hash, entry)
+	return result, nil
 }
 
-// IndexCat displays the contents of an index in a table format.
-func IndexCat(logger hclog.Logger, indexName string) error {
+// IndexCat displays the contents of an index in the given output format.
+func IndexCat(logger hclog.Logger, dbPath, indexName string, format OutputFormat) error {
 	if indexName == "" {
 		return errors.New("index name cannot be empty")
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -237,7 +516,15 @@ func IndexCat(logger hclog.Logger, indexName string) error {
 			return err
 		}
 
-		rows := []string{"SHA-256|Bytes|Timestamp|Content Type|Path(s)"}
+		header := []string{"SHA-256", "Bytes", "Timestamp", "Content Type", "Path(s)"}
+		if format == FormatCSV {
+			header = []string{"sha256", "size", "timestamp", "content_type", "path", "attachments"}
+		}
+		out, err := newRecordWriter(os.Stdout, format, header)
+		if err != nil {
+			return err
+		}
+
 		cursor := bucket.Cursor()
 		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
 			entry, err := decodeEntry(entryData)
@@ -245,26 +532,17 @@ func IndexCat(logger hclog.Logger, indexName string) error {
 				return fmt.Errorf("failed to decode entry: %w", err)
 			}
 
-			// Get sorted list of paths for consistent output
-			paths := make([]string, 0, len(entry.Paths))
-			for p := range entry.Paths {
-				paths = append(paths, p)
+			if err := out.write(newEntryJSON(hash, entry), entryRows(format, hash, entry)...); err != nil {
+				return err
 			}
-			sort.Strings(paths)
-
-			row := fmt.Sprintf("%x|%d|%s|%s|%s",
-				hash, entry.Size, entry.Timestamp.Format(time.RFC3339),
-				entry.ContentType, strings.Join(paths, ","))
-			rows = append(rows, row)
 		}
 
-		fmt.Println(columnize.SimpleFormat(rows))
-		return nil
+		return out.close()
 	})
 }
 
 // IndexChunk splits an index into multiple smaller indexes.
-func IndexChunk(logger hclog.Logger, indexName, targetIndexPrefix string, chunkSize int) error {
+func IndexChunk(logger hclog.Logger, dbPath, indexName, targetIndexPrefix string, chunkSize int) error {
 	if indexName == "" {
 		return errors.New("index name cannot be empty")
 	}
@@ -275,7 +553,7 @@ func IndexChunk(logger hclog.Logger, indexName, targetIndexPrefix string, chunkS
 		return errors.New("chunk size must be positive")
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -316,9 +594,9 @@ func IndexChunk(logger hclog.Logger, indexName, targetIndexPrefix string, chunkS
 	})
 }
 
-// IndexList lists all indexes in the database.
-func IndexList(logger hclog.Logger) error {
-	db, err := getDB()
+// IndexList lists all indexes in the database in the given output format.
+func IndexList(logger hclog.Logger, dbPath string, format OutputFormat) error {
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -330,21 +608,59 @@ func IndexList(logger hclog.Logger) error {
 			return err
 		}
 
+		// The table format keeps the plain one-name-per-line listing
+		if format == FormatTable {
+			cursor := bucket.Cursor()
+			for indexName, _ := cursor.First(); indexName != nil; indexName, _ = cursor.Next() {
+				fmt.Println(string(indexName))
+			}
+			return nil
+		}
+
+		out, err := newRecordWriter(os.Stdout, format, []string{"name"})
+		if err != nil {
+			return err
+		}
+
 		cursor := bucket.Cursor()
 		for indexName, _ := cursor.First(); indexName != nil; indexName, _ = cursor.Next() {
-			fmt.Println(string(indexName))
+			object := struct {
+				Name string `json:"name"`
+			}{string(indexName)}
+			if err := out.write(object, []string{string(indexName)}); err != nil {
+				return err
+			}
 		}
-		return nil
+		return out.close()
 	})
 }
 
-// IndexStats displays statistics about an index.
-func IndexStats(logger hclog.Logger, indexName string) error {
+// typeStats summarizes the entries of an index, either in total or for one
+// content type.
+type typeStats struct {
+	Hashes          int   `json:"hashes"`
+	Files           int   `json:"files"`
+	DuplicateHashes int   `json:"duplicate_hashes"`
+	Bytes           int64 `json:"bytes"`
+}
+
+// add counts an entry in the stats.
+func (s *typeStats) add(entry *indexEntry) {
+	s.Hashes++
+	s.Files += len(entry.Paths)
+	s.Bytes += entry.Size
+	if len(entry.Paths) > 1 {
+		s.DuplicateHashes++
+	}
+}
+
+// IndexStats displays statistics about an index in the given output format.
+func IndexStats(logger hclog.Logger, dbPath, indexName string, format OutputFormat) error {
 	if indexName == "" {
 		return errors.New("index name cannot be empty")
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -357,11 +673,8 @@ func IndexStats(logger hclog.Logger, indexName string) error {
 		}
 
 		var (
-			hashCount     int
-			totalBytes    int64
-			fileCount     int
-			duplicateHash int
-			contentTypes  = make(map[string]int)
+			total        typeStats
+			contentTypes = make(map[string]*typeStats)
 		)
 
 		cursor := bucket.Cursor()
@@ -371,40 +684,72 @@ func IndexStats(logger hclog.Logger, indexName string) error {
 				return fmt.Errorf("failed to decode entry: %w", err)
 			}
 
-			hashCount++
-			totalBytes += entry.Size
-			fileCount += len(entry.Paths)
-
-			if len(entry.Paths) > 1 {
-				duplicateHash++
+			total.add(entry)
+			stats, ok := contentTypes[entry.ContentType]
+			if !ok {
+				stats = &typeStats{}
+				contentTypes[entry.ContentType] = stats
 			}
+			stats.add(entry)
+		}
 
-			contentTypes[entry.ContentType]++
+		types := make([]string, 0, len(contentTypes))
+		for contentType := range contentTypes {
+			types = append(types, contentType)
+		}
+		sort.Strings(types)
+
+		switch format {
+		case FormatJSON, FormatJSONL:
+			return writeJSON(os.Stdout, format, struct {
+				typeStats
+				ContentTypes map[string]*typeStats `json:"content_types"`
+			}{total, contentTypes})
+
+		case FormatCSV:
+			out, err := newRecordWriter(os.Stdout, format,
+				[]string{"content_type", "hashes", "files", "duplicate_hashes", "bytes"})
+			if err != nil {
+				return err
+			}
+			for _, contentType := range types {
+				stats := contentTypes[contentType]
+				row := []string{
+					contentType,
+					strconv.Itoa(stats.Hashes),
+					strconv.Itoa(stats.Files),
+					strconv.Itoa(stats.DuplicateHashes),
+					strconv.FormatInt(stats.Bytes, 10),
+				}
+				if err := out.write(nil, row); err != nil {
+					return err
+				}
+			}
+			return out.close()
 		}
 
 		// Display content type distribution
 		rows := []string{"File Type|Hash Count"}
-		for contentType, count := range contentTypes {
-			rows = append(rows, fmt.Sprintf("%s|%d", contentType, count))
+		for _, contentType := range types {
+			rows = append(rows, fmt.Sprintf("%s|%d", contentType, contentTypes[contentType].Hashes))
 		}
-		sort.Strings(rows[1:]) // Sort all but the header
 		fmt.Println(columnize.SimpleFormat(rows))
 		fmt.Println()
 
 		// Display summary
 		fmt.Printf("%d hashes for %d files (%d hashes with duplicates); %d bytes total\n",
-			hashCount, fileCount, duplicateHash, totalBytes)
+			total.Hashes, total.Files, total.DuplicateHashes, total.Bytes)
 		return nil
 	})
 }
 
 // IndexDelete deletes an index from the database.
-func IndexDelete(logger hclog.Logger, indexName string) error {
+func IndexDelete(logger hclog.Logger, dbPath, indexName string) error {
 	if indexName == "" {
 		return errors.New("index name cannot be empty")
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -100,7 +100,7 @@ func TestCountFiles(t *testing.T) {
 		}
 	}
 
-	count, err := countFiles(logger, tmpDir)
+	count, err := countFiles(logger, tmpDir, nil)
 	if err != nil {
 		t.Fatalf("countFiles() error = %v", err)
 	}
@@ -114,7 +114,7 @@ func TestCountFiles_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := hclog.NewNullLogger()
 
-	count, err := countFiles(logger, tmpDir)
+	count, err := countFiles(logger, tmpDir, nil)
 	if err != nil {
 		t.Fatalf("countFiles() error = %v", err)
 	}
@@ -127,14 +127,14 @@ func TestCountFiles_EmptyDirectory(t *testing.T) {
 func TestCountFiles_NonExistentPath(t *testing.T) {
 	logger := hclog.NewNullLogger()
 
-	_, err := countFiles(logger, "/nonexistent/path")
+	_, err := countFiles(logger, "/nonexistent/path", nil)
 	if err == nil {
 		t.Error("countFiles() expected error for nonexistent path")
 	}
 }
 
 func TestIndexAddFiles(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	tmpDir := t.TempDir()
 
@@ -152,13 +152,13 @@ func TestIndexAddFiles(t *testing.T) {
 	}
 
 	logger := hclog.NewNullLogger()
-	err := IndexAddFiles(logger, "test-index", tmpDir)
+	err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{})
 	if err != nil {
 		t.Fatalf("IndexAddFiles() error = %v", err)
 	}
 
 	// Verify files were indexed
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		t.Fatalf("failed to open database for verification: %v", err)
 	}
@@ -190,6 +190,7 @@ func TestIndexAddFiles(t *testing.T) {
 }
 
 func TestIndexAddFiles_Errors(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
 	tests := []struct {
@@ -220,7 +221,7 @@ func TestIndexAddFiles_Errors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := IndexAddFiles(logger, tt.indexName, tt.rootPath)
+			err := IndexAddFiles(logger, dbPath, tt.indexName, tt.rootPath, IndexAddOptions{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("IndexAddFiles() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -229,7 +230,7 @@ func TestIndexAddFiles_Errors(t *testing.T) {
 }
 
 func TestIndexCat(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test index with data
 	hash := sha256.Sum256([]byte("test content"))
@@ -244,7 +245,7 @@ func TestIndexCat(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -256,23 +257,24 @@ func TestIndexCat(t *testing.T) {
 
 	// Redirect stdout to capture output (in a real test environment)
 	// For now, just verify it doesn't error
-	err := IndexCat(logger, "test-index")
+	err := IndexCat(logger, dbPath, "test-index", FormatTable)
 	if err != nil {
 		t.Fatalf("IndexCat() error = %v", err)
 	}
 }
 
 func TestIndexCat_EmptyIndexName(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
-	err := IndexCat(logger, "")
+	err := IndexCat(logger, dbPath, "", FormatTable)
 	if err == nil {
 		t.Error("IndexCat() expected error for empty index name")
 	}
 }
 
 func TestIndexChunk(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test index with multiple entries
 	indexData := make(map[string]*indexEntry)
@@ -288,7 +290,7 @@ func TestIndexChunk(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -297,7 +299,7 @@ func TestIndexChunk(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := IndexChunk(logger, "source-index", "chunk", 3)
+	err := IndexChunk(logger, dbPath, "source-index", "chunk", 3)
 	if err != nil {
 		t.Fatalf("IndexChunk() error = %v", err)
 	}
@@ -308,7 +310,7 @@ func TestIndexChunk(t *testing.T) {
 
 	for _, chunkName := range expectedChunks {
 		func() {
-			db, err := getDB()
+			db, err := getDB(dbPath)
 			if err != nil {
 				t.Fatalf("failed to open database for verification: %v", err)
 			}
@@ -327,6 +329,7 @@ func TestIndexChunk(t *testing.T) {
 }
 
 func TestIndexChunk_Errors(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
 	tests := []struct {
@@ -373,7 +376,7 @@ func TestIndexChunk_Errors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := IndexChunk(logger, tt.indexName, tt.targetName, tt.chunkSize)
+			err := IndexChunk(logger, dbPath, tt.indexName, tt.targetName, tt.chunkSize)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("IndexChunk() error = %v, wantErr %v (%s)", err, tt.wantErr, tt.description)
 			}
@@ -382,12 +385,12 @@ func TestIndexChunk_Errors(t *testing.T) {
 }
 
 func TestIndexList(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create multiple indexes
 	indexNames := []string{"index1", "index2", "index3"}
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -400,14 +403,14 @@ func TestIndexList(t *testing.T) {
 	logger := hclog.NewNullLogger()
 
 	// Just verify it doesn't error (output goes to stdout)
-	err := IndexList(logger)
+	err := IndexList(logger, dbPath, FormatTable)
 	if err != nil {
 		t.Fatalf("IndexList() error = %v", err)
 	}
 }
 
 func TestIndexStats(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test index with various content types
 	hash1 := sha256.Sum256([]byte("content1"))
@@ -439,7 +442,7 @@ func TestIndexStats(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -448,27 +451,28 @@ func TestIndexStats(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := IndexStats(logger, "test-index")
+	err := IndexStats(logger, dbPath, "test-index", FormatTable)
 	if err != nil {
 		t.Fatalf("IndexStats() error = %v", err)
 	}
 }
 
 func TestIndexStats_EmptyIndexName(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
-	err := IndexStats(logger, "")
+	err := IndexStats(logger, dbPath, "", FormatTable)
 	if err == nil {
 		t.Error("IndexStats() expected error for empty index name")
 	}
 }
 
 func TestIndexDelete(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test index
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -477,14 +481,14 @@ func TestIndexDelete(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := IndexDelete(logger, "test-index")
+	err := IndexDelete(logger, dbPath, "test-index")
 	if err != nil {
 		t.Fatalf("IndexDelete() error = %v", err)
 	}
 
 	// Verify index was deleted
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database for verification: %v", err)
 		}
@@ -503,17 +507,16 @@ func TestIndexDelete(t *testing.T) {
 }
 
 func TestIndexDelete_EmptyIndexName(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
-	err := IndexDelete(logger, "")
+	err := IndexDelete(logger, dbPath, "")
 	if err == nil {
 		t.Error("IndexDelete() expected error for empty index name")
 	}
 }
 
 func TestMakeFileEntry(t *testing.T) {
-	db := setupTestDatabase(t)
-
 	tmpDir := t.TempDir()
 	logger := hclog.NewNullLogger()
 
@@ -529,39 +532,197 @@ func TestMakeFileEntry(t *testing.T) {
 		t.Fatalf("failed to stat test file: %v", err)
 	}
 
+	hash, entry, err := makeFileEntry(logger, filePath, info)
+	if err != nil {
+		t.Fatalf("makeFileEntry() error = %v", err)
+	}
+
+	// Verify hash is correct
+	expectedHash := sha256.Sum256(content)
+	if string(hash) != string(expectedHash[:]) {
+		t.Errorf("hash mismatch")
+	}
+
+	// Verify entry fields
+	if entry.Size != int64(len(content)) {
+		t.Errorf("entry.Size = %v, want %v", entry.Size, len(content))
+	}
+
+	if _, exists := entry.Paths[filePath]; !exists {
+		t.Errorf("entry.Paths missing %q", filePath)
+	}
+
+	if entry.ContentType != "application/octet-stream" {
+		t.Errorf("entry.ContentType = %v, want application/octet-stream", entry.ContentType)
+	}
+}
+
+func TestIndexAddFiles_Parallel(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+
+	// More files than a single batch, with every content written twice so
+	// duplicates land on different workers
+	const distinct = indexBatchSize + 10
+	for i := 0; i < distinct; i++ {
+		content := []byte(fmt.Sprintf("content %d", i))
+		for _, dir := range []string{"a", "b"} {
+			filePath := filepath.Join(tmpDir, dir, fmt.Sprintf("file%d.txt", i))
+			if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(filePath, content, 0644); err != nil {
+				t.Fatalf("failed to create test file: %v", err)
+			}
+		}
+	}
+
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{Workers: 8}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database for verification: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		cursor := bucket.Cursor()
+		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+			entry, err := decodeEntry(entryData)
+			if err != nil {
+				return err
+			}
+			if len(entry.Paths) != 2 {
+				t.Errorf("entry %x has %d paths, want 2", hash, len(entry.Paths))
+			}
+			count++
+		}
+
+		if count != distinct {
+			t.Errorf("indexed %v hashes, want %v", count, distinct)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
+
+func TestPutIndexedFile(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	hash := sha256.Sum256([]byte("content"))
+	original := mustParseTime(t, "2020-01-01T00:00:00Z")
+	taken := mustParseTime(t, "2010-01-01T00:00:00Z")
+
+	filePath := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(filePath, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+
 	err = db.Update(func(tx *bolt.Tx) error {
 		bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
 		if err != nil {
 			return err
 		}
 
-		hash, entry, err := makeFileEntry(logger, bucket, filePath, info)
+		pathsBucket, err := getBucketForIndex(tx, "test-index", pathsBucketKey)
 		if err != nil {
-			t.Fatalf("makeFileEntry() error = %v", err)
+			return err
 		}
 
-		// Verify hash is correct
-		expectedHash := sha256.Sum256(content)
-		if string(hash) != string(expectedHash[:]) {
-			t.Errorf("hash mismatch")
+		changes := &pathChanges{}
+		first := &indexedFile{
+			hash: hash[:],
+			entry: &indexEntry{
+				Paths:       map[string]struct{}{"a.jpg": {}},
+				Attachments: map[string]string{},
+				Size:        7,
+				Timestamp:   original,
+				ContentType: "image/jpeg",
+			},
+			path: "a.jpg",
+			info: info,
+		}
+		if err := putIndexedFile(bucket, pathsBucket, first, changes); err != nil {
+			return err
 		}
 
-		// Verify entry fields
-		if entry.Size != int64(len(content)) {
-			t.Errorf("entry.Size = %v, want %v", entry.Size, len(content))
+		second := &indexedFile{
+			hash: hash[:],
+			entry: &indexEntry{
+				Paths:       map[string]struct{}{"b.jpg": {}},
+				Attachments: map[string]string{".json": "b.jpg.json"},
+				Size:        7,
+				Timestamp:   taken,
+				ContentType: "image/jpeg",
+			},
+			path:              "b.jpg",
+			info:              info,
+			metadataTimestamp: true,
+		}
+		if err := putIndexedFile(bucket, pathsBucket, second, changes); err != nil {
+			return err
+		}
+		if changes.added != 2 {
+			t.Errorf("changes.added = %d, want 2", changes.added)
 		}
 
-		if _, exists := entry.Paths[filePath]; !exists {
-			t.Errorf("entry.Paths missing %q", filePath)
+		entry, err := getEntry(bucket, hash[:])
+		if err != nil {
+			return err
+		}
+		if len(entry.Paths) != 2 {
+			t.Errorf("entry has %d paths, want 2", len(entry.Paths))
+		}
+		if entry.Attachments[".json"] != "b.jpg.json" {
+			t.Errorf("entry.Attachments = %v, want .json attachment", entry.Attachments)
+		}
+		if !entry.Timestamp.Equal(taken) {
+			t.Errorf("entry.Timestamp = %v, want metadata timestamp %v", entry.Timestamp, taken)
 		}
 
-		if entry.ContentType != "application/octet-stream" {
-			t.Errorf("entry.ContentType = %v, want application/octet-stream", entry.ContentType)
+		// Re-indexing a path with new content moves it to the new hash
+		newHash := sha256.Sum256([]byte("new content"))
+		third := &indexedFile{
+			hash: newHash[:],
+			entry: &indexEntry{
+				Paths:       map[string]struct{}{"a.jpg": {}},
+				Attachments: map[string]string{},
+			},
+			path: "a.jpg",
+			info: info,
+		}
+		if err := putIndexedFile(bucket, pathsBucket, third, changes); err != nil {
+			return err
+		}
+		if changes.changed != 1 {
+			t.Errorf("changes.changed = %d, want 1", changes.changed)
 		}
 
+		entry, err = getEntry(bucket, hash[:])
+		if err != nil {
+			return err
+		}
+		if _, ok := entry.Paths["a.jpg"]; ok || len(entry.Paths) != 1 {
+			t.Errorf("old entry paths = %v, want only b.jpg", entry.Paths)
+		}
 		return nil
 	})
-
 	if err != nil {
 		t.Fatalf("transaction error = %v", err)
 	}
@@ -576,3 +737,76 @@ func mustParseTime(t *testing.T, s string) time.Time {
 	}
 	return ts
 }
+
+func TestIndexAddFiles_SkipsUnchanged(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	filePath := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(filePath, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	// Rewrite the file in place with the same size and restore its mtime, so
+	// only a rehash can notice the new content
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+	f, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("modified"), 0); err != nil {
+		t.Fatalf("failed to rewrite test file: %v", err)
+	}
+	f.Close()
+	if err := os.Chtimes(filePath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to restore mtime: %v", err)
+	}
+
+	originalHash := sha256.Sum256([]byte("original"))
+	modifiedHash := sha256.Sum256([]byte("modified"))
+
+	hasHash := func(hash []byte) bool {
+		t.Helper()
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		found := false
+		err = db.View(func(tx *bolt.Tx) error {
+			bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
+			if err != nil {
+				return err
+			}
+			found = bucket.Get(hash) != nil
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("verification error = %v", err)
+		}
+		return found
+	}
+
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("second IndexAddFiles() error = %v", err)
+	}
+	if !hasHash(originalHash[:]) || hasHash(modifiedHash[:]) {
+		t.Error("unchanged-looking file was rehashed without --rehash")
+	}
+
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{Rehash: true}); err != nil {
+		t.Fatalf("rehash IndexAddFiles() error = %v", err)
+	}
+	if !hasHash(modifiedHash[:]) {
+		t.Error("rehash did not pick up the modified content")
+	}
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// layoutPresets maps the named materialize layouts to their templates.
+var layoutPresets = map[string]string{
+	"hash":     "{hashdir}/{hash}{ext}",
+	"date":     "{year}/{month}/{day}/{name}",
+	"original": "{dir}/{name}",
+}
+
+// layoutFields lists the fields a layout template may use.
+var layoutFields = map[string]bool{
+	"hash":     true,
+	"hash8":    true,
+	"hashdir":  true,
+	"year":     true,
+	"month":    true,
+	"day":      true,
+	"name":     true,
+	"basename": true,
+	"ext":      true,
+	"dir":      true,
+}
+
+// Layout decides where each file lands in a materialized tree.
+type Layout struct {
+	spec  string
+	parts []layoutPart
+}
+
+// layoutPart is either literal text or a field to substitute.
+type layoutPart struct {
+	literal string
+	field   string
+}
+
+// HashLayout is the content-addressable layout materialize uses by default.
+var HashLayout = mustParseLayout("hash")
+
+// ParseLayout parses a preset layout name (hash, date or original) or a
+// template such as "{year}/{month}/{basename}-{hash8}{ext}".
+func ParseLayout(s string) (Layout, error) {
+	template, ok := layoutPresets[s]
+	if !ok {
+		template = s
+	}
+	if template == "" {
+		return Layout{}, errors.New("layout cannot be empty")
+	}
+
+	l := Layout{spec: s}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			l.parts = append(l.parts, layoutPart{literal: rest})
+			break
+		}
+		if open > 0 {
+			l.parts = append(l.parts, layoutPart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return Layout{}, fmt.Errorf("unterminated field in layout %q", s)
+		}
+		field := rest[open+1 : open+end]
+		if !layoutFields[field] {
+			return Layout{}, fmt.Errorf("unknown field {%s} in layout %q", field, s)
+		}
+		l.parts = append(l.parts, layoutPart{field: field})
+		rest = rest[open+end+1:]
+	}
+	return l, nil
+}
+
+func mustParseLayout(s string) Layout {
+	l, err := ParseLayout(s)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// String returns the layout as it was given to ParseLayout.
+func (l Layout) String() string {
+	return l.spec
+}
+
+// usesField reports whether the layout substitutes the given field.
+func (l Layout) usesField(field string) bool {
+	for _, p := range l.parts {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutFile holds what a layout needs to know about one materialized file.
+type layoutFile struct {
+	hash      []byte
+	src       string
+	timestamp time.Time
+	// root is the directory {dir} is relative to.
+	root string
+}
+
+// destination expands the layout for a file into a clean path relative to
+// the materialize root. Timestamps are expanded in local time.
+func (l Layout) destination(f layoutFile) (string, error) {
+	hash := hex.EncodeToString(f.hash)
+	name := filepath.Base(f.src)
+	ext := fileExt(f.src)
+	ts := f.timestamp.Local()
+
+	var b strings.Builder
+	for _, p := range l.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "hash":
+			b.WriteString(hash)
+		case "hash8":
+			b.WriteString(hash[:8])
+		case "hashdir":
+			b.WriteString(hash[0:2] + "/" + hash[2:4])
+		case "year":
+			fmt.Fprintf(&b, "%04d", ts.Year())
+		case "month":
+			fmt.Fprintf(&b, "%02d", ts.Month())
+		case "day":
+			fmt.Fprintf(&b, "%02d", ts.Day())
+		case "name":
+			b.WriteString(name)
+		case "basename":
+			b.WriteString(strings.TrimSuffix(name, filepath.Ext(name)))
+		case "ext":
+			b.WriteString(ext)
+		case "dir":
+			rel, err := filepath.Rel(f.root, filepath.Dir(f.src))
+			if err != nil {
+				return "", fmt.Errorf("failed to get relative path: %w", err)
+			}
+			b.WriteString(filepath.ToSlash(rel))
+		}
+	}
+
+	dst := filepath.Clean(filepath.FromSlash(b.String()))
+	if filepath.IsAbs(dst) || dst == "." || dst == ".." || strings.HasPrefix(dst, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("layout %q gives %q for %q, which is outside the materialize root", l.spec, dst, f.src)
+	}
+	return dst, nil
+}
+
+// fileExt returns a file's extension, treating a bare trailing dot as no
+// extension.
+func fileExt(path string) string {
+	ext := filepath.Ext(path)
+	if ext == "." {
+		return ""
+	}
+	return ext
+}
+
+// commonDir returns the deepest directory that contains every path.
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	common := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for !isUnderRoot(common, p) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// layoutClaims tracks the destinations handed out during one materialize, so
+// colliding names can be given deterministic suffixes. Names are compared
+// case-insensitively, since the tree may land on a case-insensitive
+// filesystem.
+type layoutClaims map[string]bool
+
+// claim picks a free destination for a file and its attachments, given the
+// extensions of its attachments. Files are claimed in hash order, so the
+// first file to want a name gets it and later ones are suffixed with their
+// short hash, then their full hash. That keeps re-runs of the same index
+// idempotent.
+func (c layoutClaims) claim(dst string, hash []byte, attachmentExts []string) (string, error) {
+	hexHash := hex.EncodeToString(hash)
+	for _, suffix := range []string{"", "-" + hexHash[:8], "-" + hexHash} {
+		candidate := dst
+		if suffix != "" {
+			ext := fileExt(dst)
+			candidate = strings.TrimSuffix(dst, ext) + suffix + ext
+		}
+
+		names := []string{candidate}
+		for _, ext := range attachmentExts {
+			names = append(names, attachmentPath(candidate, ext))
+		}
+		free := true
+		for _, name := range names {
+			if c[strings.ToLower(name)] {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+
+		for _, name := range names {
+			c[strings.ToLower(name)] = true
+		}
+		return candidate, nil
+	}
+	return "", fmt.Errorf("no free destination for %q", dst)
+}
+
+// attachmentPath returns where an attachment with the given extension goes,
+// next to the materialized file at dst.
+func attachmentPath(dst, attachExt string) string {
+	return strings.TrimSuffix(dst, fileExt(dst)) + attachExt
+}
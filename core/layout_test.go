@@ -0,0 +1,123 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"hash", false},
+		{"date", false},
+		{"original", false},
+		{"{year}/{month}/{basename}-{hash8}{ext}", false},
+		{"flat/{name}", false},
+		{"", true},
+		{"{year", true},
+		{"{bogus}/{name}", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLayout(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.input {
+				t.Errorf("String() = %q, want %q", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestLayout_Destination(t *testing.T) {
+	hash := sha256.Sum256([]byte("photo"))
+	hexHash := hex.EncodeToString(hash[:])
+	file := layoutFile{
+		hash:      hash[:],
+		src:       "/photos/2019/trip/IMG_0001.JPG",
+		timestamp: time.Date(2019, 7, 4, 12, 0, 0, 0, time.Local),
+		root:      "/photos",
+	}
+
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{"hash", filepath.Join(hexHash[0:2], hexHash[2:4], hexHash+".JPG")},
+		{"date", filepath.Join("2019", "07", "04", "IMG_0001.JPG")},
+		{"original", filepath.Join("2019", "trip", "IMG_0001.JPG")},
+		{"{year}/{month}/{basename}-{hash8}{ext}", filepath.Join("2019", "07", "IMG_0001-"+hexHash[:8]+".JPG")},
+		{"../{name}", ""},
+		{"/abs/{name}", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			layout, err := ParseLayout(tt.layout)
+			if err != nil {
+				t.Fatalf("ParseLayout() error = %v", err)
+			}
+			got, err := layout.destination(file)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("destination() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("destination() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("destination() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"/a/b/c.txt"}, "/a/b"},
+		{[]string{"/a/b/c.txt", "/a/b/d/e.txt"}, "/a/b"},
+		{[]string{"/a/b/c.txt", "/a/x/e.txt"}, "/a"},
+		{[]string{"/a/bc/c.txt", "/a/b/e.txt"}, "/a"},
+		{[]string{"/a/c.txt", "/x/e.txt"}, "/"},
+	}
+
+	for _, tt := range tests {
+		if got := commonDir(tt.paths); got != filepath.FromSlash(tt.want) {
+			t.Errorf("commonDir(%v) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutClaims(t *testing.T) {
+	first := sha256.Sum256([]byte("first"))
+	second := sha256.Sum256([]byte("second"))
+	hexSecond := hex.EncodeToString(second[:])
+
+	claims := make(layoutClaims)
+	got, err := claims.claim("2019/IMG.jpg", first[:], []string{".json"})
+	if err != nil || got != "2019/IMG.jpg" {
+		t.Fatalf("first claim() = %q, %v", got, err)
+	}
+
+	// A different case, or only a clashing attachment, still collides
+	got, err = claims.claim("2019/img.JPG", second[:], nil)
+	if err != nil || got != "2019/img-"+hexSecond[:8]+".JPG" {
+		t.Errorf("second claim() = %q, %v", got, err)
+	}
+	got, err = claims.claim("2019/IMG.png", second[:], []string{".json"})
+	if err != nil || got != "2019/IMG-"+hexSecond[:8]+".png" {
+		t.Errorf("attachment claim() = %q, %v", got, err)
+	}
+}
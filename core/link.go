@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LinkMode selects how a file is made to share the content of another file.
+type LinkMode string
+
+const (
+	// LinkHardlink creates a hard link, so both paths are the same inode.
+	LinkHardlink LinkMode = "hardlink"
+	// LinkReflink creates a copy-on-write clone that shares data blocks.
+	LinkReflink LinkMode = "reflink"
+	// LinkSymlink creates a symbolic link to the absolute source path.
+	LinkSymlink LinkMode = "symlink"
+	// LinkCopy copies the data, so the files share nothing.
+	LinkCopy LinkMode = "copy"
+)
+
+// ParseLinkMode parses a link mode name.
+func ParseLinkMode(s string) (LinkMode, error) {
+	switch m := LinkMode(s); m {
+	case LinkHardlink, LinkReflink, LinkSymlink, LinkCopy:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown link mode %q (want hardlink, reflink, symlink or copy)", s)
+}
+
+// linkFile makes dst a link to src using the given mode. The link is created
+// under a temporary name and renamed into place, so an existing dst is
+// replaced atomically.
+func linkFile(mode LinkMode, src, dst string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), ".venn-tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	// Ensure cleanup on error
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpName)
+		}
+	}()
+
+	switch mode {
+	case LinkReflink:
+		err = reflinkInto(src, tmpFile)
+	case LinkHardlink, LinkSymlink:
+		// Only the unique name is needed; the link takes its place
+		tmpFile.Close()
+		if err := os.Remove(tmpName); err != nil {
+			return fmt.Errorf("failed to remove temporary file: %w", err)
+		}
+		if mode == LinkHardlink {
+			err = os.Link(src, tmpName)
+		} else {
+			var abs string
+			if abs, err = filepath.Abs(src); err == nil {
+				err = os.Symlink(abs, tmpName)
+			}
+		}
+	default:
+		tmpFile.Close()
+		return fmt.Errorf("unknown link mode %q", mode)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s %q: %w", mode, src, err)
+	}
+
+	if err := os.Rename(tmpName, dst); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+
+	success = true
+	return nil
+}
+
+// reflinkInto clones src into the open temporary file and closes it.
+func reflinkInto(src string, tmpFile *os.File) error {
+	defer tmpFile.Close()
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := reflinkFile(in, tmpFile); err != nil {
+		return err
+	}
+	return tmpFile.Close()
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLinkMode(t *testing.T) {
+	for _, s := range []string{"hardlink", "reflink", "symlink", "copy"} {
+		if got, err := ParseLinkMode(s); err != nil || string(got) != s {
+			t.Errorf("ParseLinkMode(%q) = %q, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "clone", "Hardlink"} {
+		if _, err := ParseLinkMode(s); err == nil {
+			t.Errorf("ParseLinkMode(%q) expected error", s)
+		}
+	}
+}
+
+func TestLinkFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	src := filepath.Join(tmpDir, "src.txt")
+	if err := os.WriteFile(src, []byte("shared content"), 0644); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+
+	t.Run("hardlink replaces existing file", func(t *testing.T) {
+		dst := filepath.Join(tmpDir, "hard.txt")
+		if err := os.WriteFile(dst, []byte("shared content"), 0644); err != nil {
+			t.Fatalf("failed to create destination file: %v", err)
+		}
+
+		if err := linkFile(LinkHardlink, src, dst); err != nil {
+			t.Fatalf("linkFile() error = %v", err)
+		}
+
+		srcInfo, _ := os.Stat(src)
+		dstInfo, _ := os.Stat(dst)
+		if !os.SameFile(srcInfo, dstInfo) {
+			t.Error("destination is not a hard link to the source")
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		dst := filepath.Join(tmpDir, "sym.txt")
+		if err := linkFile(LinkSymlink, src, dst); err != nil {
+			t.Fatalf("linkFile() error = %v", err)
+		}
+
+		target, err := os.Readlink(dst)
+		if err != nil {
+			t.Fatalf("destination is not a symlink: %v", err)
+		}
+		if !filepath.IsAbs(target) {
+			t.Errorf("symlink target %q is not absolute", target)
+		}
+	})
+
+	t.Run("unknown mode leaves no temporary files", func(t *testing.T) {
+		if err := linkFile("bogus", src, filepath.Join(tmpDir, "bogus.txt")); err == nil {
+			t.Fatal("linkFile() expected error for unknown mode")
+		}
+
+		matches, _ := filepath.Glob(filepath.Join(tmpDir, ".venn-tmp-*"))
+		if len(matches) != 0 {
+			t.Errorf("temporary files left behind: %v", matches)
+		}
+	})
+}
@@ -0,0 +1,300 @@
+package core
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/ryanuber/columnize"
+)
+
+// materializeManifestName is the manifest written at the root of a
+// materialized tree, mapping each file back to where it came from.
+const materializeManifestName = ".venn-manifest.jsonl"
+
+// manifestRecord is one line of a materialize manifest.
+type manifestRecord struct {
+	// Path is the materialized file, relative to the root with forward
+	// slashes.
+	Path   string `json:"path"`
+	Index  string `json:"index"`
+	SHA256 string `json:"sha256"`
+
+	// Source is the path the file was placed from, and OtherPaths are the
+	// rest of the paths in the index with the same content.
+	Source     string   `json:"source"`
+	OtherPaths []string `json:"other_paths"`
+
+	Timestamp time.Time `json:"timestamp"`
+
+	// Attachments maps each materialized attachment, relative to the root,
+	// to the path it was placed from.
+	Attachments map[string]string `json:"attachments,omitempty"`
+}
+
+// newManifestRecord returns the manifest record for a planned item.
+func newManifestRecord(indexName string, item *materializeItem) manifestRecord {
+	other := make([]string, 0, len(item.entry.Paths)-1)
+	for _, p := range sortedPaths(item.entry) {
+		if p != item.src {
+			other = append(other, p)
+		}
+	}
+
+	var attachments map[string]string
+	if len(item.entry.Attachments) > 0 {
+		attachments = make(map[string]string, len(item.entry.Attachments))
+		for ext, src := range item.entry.Attachments {
+			attachments[filepath.ToSlash(attachmentPath(item.dst, ext))] = src
+		}
+	}
+
+	return manifestRecord{
+		Path:        filepath.ToSlash(item.dst),
+		Index:       indexName,
+		SHA256:      hex.EncodeToString(item.hash),
+		Source:      item.src,
+		OtherPaths:  other,
+		Timestamp:   item.entry.Timestamp,
+		Attachments: attachments,
+	}
+}
+
+// writeMaterializeManifest writes the manifest at the root of a materialized
+// tree with one record per item, skipping the hashes that failed. With merge,
+// the records other indexes materialized into the same root are kept, except
+// for files this run placed over; otherwise the manifest is replaced. It's
+// written through a temporary file so a reader never sees a partial manifest.
+func writeMaterializeManifest(rootPath, indexName string, items []*materializeItem, failed map[string]bool, merge bool) error {
+	if err := os.MkdirAll(rootPath, materializedDirMode); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", rootPath, err)
+	}
+
+	tmpFile, err := os.CreateTemp(rootPath, ".venn-tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	// Ensure cleanup on error
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpName)
+		}
+	}()
+
+	var kept []manifestRecord
+	if merge {
+		if kept, err = otherManifestRecords(rootPath, indexName, items, failed); err != nil {
+			tmpFile.Close()
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(tmpFile)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, record := range kept {
+		if err := enc.Encode(record); err != nil {
+			tmpFile.Close()
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	if err := encodeManifest(w, indexName, items, failed); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmpName, filepath.Join(rootPath, materializeManifestName)); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+
+	success = true
+	return nil
+}
+
+// otherManifestRecords returns the records in the manifest at a root that
+// belong to other indexes and that none of the placed items replaced.
+func otherManifestRecords(rootPath, indexName string, items []*materializeItem, failed map[string]bool) ([]manifestRecord, error) {
+	previous, err := readManifest(filepath.Join(rootPath, materializeManifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	placed := make(map[string]bool)
+	for _, item := range items {
+		if failed[string(item.hash)] {
+			continue
+		}
+		placed[filepath.ToSlash(item.dst)] = true
+		for ext := range item.entry.Attachments {
+			placed[filepath.ToSlash(attachmentPath(item.dst, ext))] = true
+		}
+	}
+
+	var kept []manifestRecord
+	for _, record := range previous {
+		if record.Index != indexName && !placed[record.Path] {
+			kept = append(kept, record)
+		}
+	}
+	return kept, nil
+}
+
+// encodeManifest writes one manifest record per item, skipping the hashes
+// that failed.
+func encodeManifest(w io.Writer, indexName string, items []*materializeItem, failed map[string]bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, item := range items {
+		if failed[string(item.hash)] {
+			continue
+		}
+		if err := enc.Encode(newManifestRecord(indexName, item)); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// readManifest returns every record in a manifest. A missing manifest has no
+// records.
+func readManifest(manifest string) ([]manifestRecord, error) {
+	f, err := os.Open(manifest)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var records []manifestRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid manifest record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return records, nil
+}
+
+// findMaterializeManifest looks for the manifest of the materialized tree
+// holding a file, starting in the file's folder and working up. It returns
+// the manifest path and the file's path relative to it.
+func findMaterializeManifest(path string) (string, string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	for dir := filepath.Dir(abs); ; {
+		manifest := filepath.Join(dir, materializeManifestName)
+		if _, err := os.Stat(manifest); err == nil {
+			rel, err := filepath.Rel(dir, abs)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to get relative path: %w", err)
+			}
+			return manifest, filepath.ToSlash(rel), nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", fmt.Errorf("no materialize manifest found above %q", path)
+		}
+		dir = parent
+	}
+}
+
+// lookupManifest streams a manifest and returns the record for a file, or
+// for the file an attachment belongs to, given its path relative to the root.
+func lookupManifest(manifest, rel string) (*manifestRecord, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid manifest record on line %d: %w", line, err)
+		}
+		if record.Path == rel {
+			return &record, nil
+		}
+		if _, ok := record.Attachments[rel]; ok {
+			return &record, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return nil, nil
+}
+
+// Whereis prints where a materialized file came from, using the manifest at
+// the root of its materialized tree.
+func Whereis(logger hclog.Logger, path string) error {
+	if path == "" {
+		return errors.New("path cannot be empty")
+	}
+
+	manifest, rel, err := findMaterializeManifest(path)
+	if err != nil {
+		return err
+	}
+	logger.Debug("found manifest", "manifest", manifest, "path", rel)
+
+	record, err := lookupManifest(manifest, rel)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("%q is not in the manifest %q", path, manifest)
+	}
+
+	rows := []string{fmt.Sprintf("File | %s", rel)}
+	if src, ok := record.Attachments[rel]; ok {
+		rows = append(rows,
+			fmt.Sprintf("Attachment of | %s", record.Path),
+			fmt.Sprintf("Attachment source | %s", src))
+	}
+	rows = append(rows,
+		fmt.Sprintf("Index | %s", record.Index),
+		fmt.Sprintf("SHA-256 | %s", record.SHA256),
+		fmt.Sprintf("Timestamp | %s", record.Timestamp.Format(time.RFC3339)),
+		fmt.Sprintf("Source | %s", record.Source))
+	for i, p := range record.OtherPaths {
+		label := ""
+		if i == 0 {
+			label = "Other paths"
+		}
+		rows = append(rows, fmt.Sprintf("%s | %s", label, p))
+	}
+	fmt.Println(columnize.SimpleFormat(rows))
+	return nil
+}
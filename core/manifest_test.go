@@ -0,0 +1,165 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestMaterializeManifest(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	content := []byte("photo content")
+	first := filepath.Join(tmpDir, "a", "photo.jpg")
+	second := filepath.Join(tmpDir, "b", "photo.jpg")
+	attachment := filepath.Join(tmpDir, "a", "photo.jpg.json")
+	for _, p := range []string{first, second, attachment} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	hash := sha256.Sum256(content)
+	timestamp := time.Date(2018, 5, 6, 7, 8, 9, 0, time.UTC)
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", map[string]*indexEntry{
+			string(hash[:]): {
+				Paths:       map[string]struct{}{first: {}, second: {}},
+				Attachments: map[string]string{".json": attachment},
+				Size:        int64(len(content)),
+				Timestamp:   timestamp,
+			},
+		})
+	}()
+
+	outputDir := filepath.Join(tmpDir, "output")
+	logger := hclog.NewNullLogger()
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+
+	hexHash := hex.EncodeToString(hash[:])
+	rel := hexHash[0:2] + "/" + hexHash[2:4] + "/" + hexHash + ".jpg"
+	for _, lookup := range []string{rel, hexHash[0:2] + "/" + hexHash[2:4] + "/" + hexHash + ".json"} {
+		manifest, got, err := findMaterializeManifest(filepath.Join(outputDir, filepath.FromSlash(lookup)))
+		if err != nil {
+			t.Fatalf("findMaterializeManifest() error = %v", err)
+		}
+		if manifest != filepath.Join(outputDir, materializeManifestName) || got != lookup {
+			t.Errorf("findMaterializeManifest() = %q, %q", manifest, got)
+		}
+
+		record, err := lookupManifest(manifest, got)
+		if err != nil || record == nil {
+			t.Fatalf("lookupManifest(%q) = %v, %v", got, record, err)
+		}
+		if record.Path != rel || record.Index != "test-index" || record.SHA256 != hexHash {
+			t.Errorf("record = %+v", record)
+		}
+		if record.Source != first || len(record.OtherPaths) != 1 || record.OtherPaths[0] != second {
+			t.Errorf("record paths = %q, %q", record.Source, record.OtherPaths)
+		}
+		if !record.Timestamp.Equal(timestamp) {
+			t.Errorf("record timestamp = %v, want %v", record.Timestamp, timestamp)
+		}
+	}
+
+	if err := Whereis(logger, filepath.Join(outputDir, rel)); err != nil {
+		t.Errorf("Whereis() error = %v", err)
+	}
+	if err := Whereis(logger, filepath.Join(outputDir, "unknown.jpg")); err == nil {
+		t.Error("Whereis() of a file not in the manifest should fail")
+	}
+	if err := Whereis(logger, first); err == nil {
+		t.Error("Whereis() of a file outside any materialized tree should fail")
+	}
+}
+
+func TestMaterializeManifest_TwoIndexes(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	hashes := make(map[string]string)
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		for _, index := range []string{"first", "second"} {
+			content := []byte("content of " + index)
+			p := filepath.Join(tmpDir, index+".txt")
+			if err := os.WriteFile(p, content, 0644); err != nil {
+				t.Fatalf("failed to create test file: %v", err)
+			}
+			hash := sha256.Sum256(content)
+			hashes[index] = hex.EncodeToString(hash[:])
+			createTestIndex(t, db, index, map[string]*indexEntry{
+				string(hash[:]): {
+					Paths:       map[string]struct{}{p: {}},
+					Attachments: map[string]string{},
+					Size:        int64(len(content)),
+					Timestamp:   time.Now(),
+				},
+			})
+		}
+	}()
+
+	outputDir := filepath.Join(tmpDir, "output")
+	logger := hclog.NewNullLogger()
+	manifest := filepath.Join(outputDir, materializeManifestName)
+	lookup := func(index string) *manifestRecord {
+		t.Helper()
+		h := hashes[index]
+		record, err := lookupManifest(manifest, h[0:2]+"/"+h[2:4]+"/"+h+".txt")
+		if err != nil {
+			t.Fatalf("lookupManifest() error = %v", err)
+		}
+		return record
+	}
+
+	// Materializing a second index keeps the first one's records, and
+	// re-running it doesn't repeat its own
+	for _, index := range []string{"first", "second", "second"} {
+		if err := Materialize(logger, dbPath, index, outputDir, MaterializeOptions{}); err != nil {
+			t.Fatalf("Materialize(%s) error = %v", index, err)
+		}
+	}
+	records, err := readManifest(manifest)
+	if err != nil {
+		t.Fatalf("readManifest() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("manifest has %d records, want 2: %+v", len(records), records)
+	}
+	for _, index := range []string{"first", "second"} {
+		if record := lookup(index); record == nil || record.Index != index {
+			t.Errorf("record for %s = %+v", index, record)
+		}
+	}
+
+	// A sync removes the first index's files and its records with them
+	if err := Materialize(logger, dbPath, "second", outputDir, MaterializeOptions{Sync: true}); err != nil {
+		t.Fatalf("Materialize() with sync error = %v", err)
+	}
+	if record := lookup("first"); record != nil {
+		t.Errorf("record for first after sync = %+v, want none", record)
+	}
+	if record := lookup("second"); record == nil {
+		t.Error("record for second is missing after sync")
+	}
+}
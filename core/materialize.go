@@ -3,12 +3,16 @@ package core
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
@@ -21,87 +25,445 @@ const (
 	materializedFileMode = 0644
 )
 
+// MaterializeOptions controls how an index is materialized.
+type MaterializeOptions struct {
+	// Layout decides where each file lands. The zero value uses HashLayout.
+	Layout Layout
+
+	// Link is how each file is placed in the tree. The zero value copies.
+	Link LinkMode
+
+	// NoVerify skips checking each source against its hash.
+	NoVerify bool
+
+	// Workers is the number of files to place in parallel. Zero or less
+	// uses one worker per CPU.
+	Workers int
+
+	// Resume skips the files that the last run into the same root finished,
+	// according to its checkpoint.
+	Resume bool
+
+	// Sync verifies existing files against their hashes rather than
+	// trusting them, and removes files under the root that aren't part of
+	// the index, along with temporary files left by crashed runs.
+	Sync bool
+
+	// Quarantine is a directory extra files are moved into by a sync,
+	// keeping their paths relative to the root. If empty, they are deleted.
+	Quarantine string
+
+	// DryRun, with Sync, prints what the sync would remove without placing
+	// or removing anything.
+	DryRun bool
+}
+
+// materializer places files into a materialized tree.
+type materializer struct {
+	logger hclog.Logger
+	opts   MaterializeOptions
+
+	// reflinkFailed is set once a reflink fails, after which the rest of the
+	// run copies instead.
+	reflinkFailed atomic.Bool
+
+	// placed maps each file the last run recorded in the manifest, relative
+	// to the root with forward slashes, to its hex hash. It's only loaded
+	// for layouts whose names don't hold the full hash.
+	placed map[string]string
+}
+
+// materializeItem is one file planned for materialization.
+type materializeItem struct {
+	hash  []byte
+	entry *indexEntry
+	src   string
+	// dst is relative to the materialize root.
+	dst string
+}
+
+// materializeResult is the outcome of placing one item.
+type materializeResult struct {
+	item    *materializeItem
+	existed bool
+	err     error
+}
+
 // Materialize creates a materialized view of an index in the given directory.
-func Materialize(logger hclog.Logger, indexName, rootPath string) error {
+// Files are placed in parallel, and a checkpoint of the finished files is kept
+// in the database so an interrupted or failed run can be resumed. A file that
+// can't be placed doesn't stop the run; every failure is reported at the end.
+// A manifest mapping every placed file back to its sources is written at the
+// root of the tree, keeping the records of other indexes materialized there.
+func Materialize(logger hclog.Logger, dbPath, indexName, rootPath string, opts MaterializeOptions) error {
 	if indexName == "" {
 		return errors.New("index name cannot be empty")
 	}
 	if rootPath == "" {
 		return errors.New("root path cannot be empty")
 	}
+	if opts.Layout.parts == nil {
+		opts.Layout = HashLayout
+	}
+	if opts.Link == "" {
+		opts.Link = LinkCopy
+	}
+	if _, err := ParseLinkMode(string(opts.Link)); err != nil {
+		return err
+	}
+	if opts.Quarantine != "" && !opts.Sync {
+		return errors.New("a quarantine directory is only used with sync")
+	}
+	if opts.DryRun && !opts.Sync {
+		return errors.New("a dry run is only used with sync")
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	m := &materializer{logger: logger, opts: opts}
 
-	db, err := getDB()
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	return db.View(func(tx *bolt.Tx) error {
-		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+	items, err := planMaterialize(db, indexName, opts.Layout)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return syncMaterialized(logger, rootPath, items, opts.Quarantine, true)
+	}
+
+	// Collision suffixes can go to a different hash once the index changes,
+	// so only a name holding the hash proves what an existing file is
+	if !opts.Sync && !opts.Layout.usesField("hash") {
+		records, err := readManifest(filepath.Join(rootPath, materializeManifestName))
 		if err != nil {
 			return err
 		}
+		m.placed = make(map[string]string, len(records))
+		for _, r := range records {
+			m.placed[r.Path] = r.SHA256
+		}
+	}
 
-		bar := pb.StartNew(bucket.Stats().KeyN)
-		defer bar.Finish()
+	finished, err := startCheckpoint(db, indexName, absRoot, opts.Resume)
+	if err != nil {
+		return err
+	}
+
+	bar := pb.StartNew(len(items))
+	defer bar.Finish()
+
+	// Queue everything the checkpoint doesn't cover
+	var pending []*materializeItem
+	resumed := 0
+	for _, item := range items {
+		if finished[string(item.hash)] == item.dst {
+			resumed++
+			continue
+		}
+		pending = append(pending, item)
+	}
+	bar.Add(resumed)
+
+	jobs := make(chan *materializeItem, workers)
+	go func() {
+		defer close(jobs)
+		for _, item := range pending {
+			jobs <- item
+		}
+	}()
+
+	results := make(chan materializeResult, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				existed, err := m.materializeItem(rootPath, item)
+				results <- materializeResult{item: item, existed: existed, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Record finished files in batches from this goroutine only
+	var (
+		placed, existed int
+		failures        []materializeResult
+		checkpointErr   error
+	)
+	batch := make([]*materializeItem, 0, indexBatchSize)
+	flush := func() {
+		if len(batch) > 0 && checkpointErr == nil {
+			checkpointErr = updateCheckpoint(db, indexName, absRoot, batch)
+		}
+		batch = batch[:0]
+	}
+	for result := range results {
+		bar.Increment()
+		switch {
+		case result.err != nil:
+			failures = append(failures, result)
+			continue
+		case result.existed:
+			existed++
+		default:
+			placed++
+		}
+
+		batch = append(batch, result.item)
+		if len(batch) == indexBatchSize {
+			flush()
+		}
+	}
+	flush()
+	bar.Finish()
+
+	failed := make(map[string]bool, len(failures))
+	for _, f := range failures {
+		failed[string(f.item.hash)] = true
+	}
+	// A sync removes every other index's files, so their records go too
+	if err := writeMaterializeManifest(rootPath, indexName, items, failed, !opts.Sync); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d files materialized, %d already present, %d resumed, %d failed\n",
+		placed, existed, resumed, len(failures))
+	if checkpointErr != nil {
+		return fmt.Errorf("failed to update checkpoint: %w", checkpointErr)
+	}
+
+	if opts.Sync {
+		if err := syncMaterialized(logger, rootPath, items, opts.Quarantine, false); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return bytes.Compare(failures[i].item.hash, failures[j].item.hash) < 0
+		})
+		fmt.Println("Failed hashes:")
+		for _, f := range failures {
+			fmt.Printf("  %x %s: %v\n", f.item.hash, f.item.src, f.err)
+		}
+		return fmt.Errorf("%d files failed to materialize; fix them and run again with --resume", len(failures))
+	}
+
+	return clearCheckpoint(db, indexName, absRoot)
+}
+
+// materializeItem places one planned file and its attachments under the root.
+// It reports whether the file was already there. Outside of sync mode an
+// existing file is trusted if its name holds its hash, or if the last run's
+// manifest recorded it with this hash. Otherwise it must match its hash or it
+// is replaced, and any missing attachments are placed next to it.
+func (m *materializer) materializeItem(rootPath string, item *materializeItem) (bool, error) {
+	src := item.src
+	dst := filepath.Join(rootPath, item.dst)
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, materializedDirMode); err != nil {
+		return false, fmt.Errorf("failed to create directory %q: %w", dir, err)
+	}
+
+	// Check if file already exists
+	existed := false
+	if _, err := os.Stat(dst); err == nil {
+		if m.trustExisting(item) {
+			m.logger.Debug("skipping existing file", "source", src, "destination", dst)
+			return true, nil
+		}
+
+		actual, err := hashFile(dst)
+		if err == nil && bytes.Equal(actual, item.hash) {
+			m.logger.Debug("skipping verified existing file", "source", src, "destination", dst)
+			existed = true
+		} else {
+			m.logger.Warn("replacing existing file that doesn't match its hash", "destination", dst, "error", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to stat %q: %w", dst, err)
+	}
+
+	if !existed {
+		if err := m.placeFile(item.hash, src, dst, item.entry.Timestamp); err != nil {
+			return false, fmt.Errorf("failed to %s %q to %q: %w", m.opts.Link, src, dst, err)
+		}
+	}
+
+	// Place attachments the same way and with the file's timestamp, without
+	// verification since they aren't hashed
+	for attachExt, attachSrc := range item.entry.Attachments {
+		attachDst := attachmentPath(dst, attachExt)
+		if existed {
+			if _, err := os.Stat(attachDst); err == nil {
+				continue
+			}
+		}
+		if err := m.placeFile(nil, attachSrc, attachDst, item.entry.Timestamp); err != nil {
+			return false, fmt.Errorf("failed to %s attachment %q to %q: %w", m.opts.Link, attachSrc, attachDst, err)
+		}
+	}
+	return existed, nil
+}
+
+// trustExisting reports whether an existing file at an item's destination
+// can be taken to hold the item's content without hashing it. A name that
+// doesn't hold the hash can't be trusted on its own, since a changed index
+// can give it to different content.
+func (m *materializer) trustExisting(item *materializeItem) bool {
+	if m.opts.Sync {
+		return false
+	}
+	if m.placed == nil {
+		return true
+	}
+	return m.placed[filepath.ToSlash(item.dst)] == hex.EncodeToString(item.hash)
+}
+
+// planMaterialize works out the source and destination of every entry in an
+// index. Entries are planned in hash order, so destinations that collide are
+// resolved the same way on every run.
+func planMaterialize(db *bolt.DB, indexName string, layout Layout) ([]*materializeItem, error) {
+	var items []*materializeItem
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
 
 		cursor := bucket.Cursor()
 		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
-			bar.Increment()
-
 			entry, err := decodeEntry(entryData)
 			if err != nil {
 				return fmt.Errorf("failed to decode entry: %w", err)
 			}
 
-			// Create directory structure based on first two bytes of hash
-			dir := filepath.Join(rootPath, fmt.Sprintf("%02x", hash[0]), fmt.Sprintf("%02x", hash[1]))
-			if err := os.MkdirAll(dir, materializedDirMode); err != nil {
-				return fmt.Errorf("failed to create directory %q: %w", dir, err)
-			}
+			// Use the first path in sorted order as the source, so the
+			// choice is deterministic
+			items = append(items, &materializeItem{
+				hash:  append([]byte(nil), hash...),
+				entry: entry,
+				src:   sortedPaths(entry)[0],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			// Get sorted list of paths to ensure deterministic behavior
-			paths := make([]string, 0, len(entry.Paths))
-			for p := range entry.Paths {
-				paths = append(paths, p)
-			}
-			sort.Strings(paths)
+	var root string
+	if layout.usesField("dir") {
+		sources := make([]string, len(items))
+		for i, item := range items {
+			sources[i] = item.src
+		}
+		root = commonDir(sources)
+	}
 
-			// Use first path as source
-			src := paths[0]
-			ext := filepath.Ext(src)
-			if ext == "." {
-				ext = ""
-			}
+	claims := make(layoutClaims)
+	for _, item := range items {
+		dst, err := layout.destination(layoutFile{
+			hash:      item.hash,
+			src:       item.src,
+			timestamp: item.entry.Timestamp,
+			root:      root,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-			name := fmt.Sprintf("%x%s", hash, ext)
-			dst := filepath.Join(dir, name)
+		attachExts := make([]string, 0, len(item.entry.Attachments))
+		for ext := range item.entry.Attachments {
+			attachExts = append(attachExts, ext)
+		}
+		sort.Strings(attachExts)
 
-			// Check if file already exists
-			if _, err := os.Stat(dst); err == nil {
-				logger.Debug("skipping existing file", "source", src, "destination", dst)
-				continue
-			} else if !os.IsNotExist(err) {
-				return fmt.Errorf("failed to stat %q: %w", dst, err)
-			}
+		item.dst, err = claims.claim(dst, item.hash, attachExts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
 
-			// Copy file with hash verification
-			if err := copyFileWithHash(hash, src, dst, entry.Timestamp); err != nil {
-				return fmt.Errorf("failed to copy %q to %q: %w", src, dst, err)
-			}
+// placeFile puts src at dst using the run's link mode. Unless verification is
+// off, src is checked against hash first; a nil hash skips the check. Copies
+// and reflinks get the given timestamp unless it's zero, while hard links and
+// symlinks leave the source's timestamp alone since they share or point at
+// its inode. If a reflink fails, a warning is logged and the rest of the run
+// falls back to copies.
+func (m *materializer) placeFile(hash []byte, src, dst string, timestamp time.Time) error {
+	mode := m.opts.Link
+	if mode == LinkReflink && m.reflinkFailed.Load() {
+		mode = LinkCopy
+	}
+	verify := hash != nil && !m.opts.NoVerify
 
-			// Copy attachments
-			for attachExt, attachSrc := range entry.Attachments {
-				attachName := fmt.Sprintf("%x%s", hash, attachExt)
-				attachDst := filepath.Join(dir, attachName)
-				if err := copyFile(attachSrc, attachDst); err != nil {
-					return fmt.Errorf("failed to copy attachment %q to %q: %w", attachSrc, attachDst, err)
-				}
-			}
+	if mode == LinkCopy {
+		if verify {
+			return copyFileWithHash(hash, src, dst, timestamp)
+		}
+		return copyFileWithTime(src, dst, timestamp)
+	}
+
+	if verify {
+		actual, err := hashFile(src)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, actual) {
+			return errors.New("hash mismatch: index is stale")
+		}
+	}
+
+	if err := linkFile(mode, src, dst); err != nil {
+		if mode != LinkReflink {
+			return err
 		}
+		if m.reflinkFailed.CompareAndSwap(false, true) {
+			m.logger.Warn("reflink failed, falling back to copies", "path", src, "error", err)
+		}
+		return copyFileWithTime(src, dst, timestamp)
+	}
+
+	if mode == LinkReflink && !timestamp.IsZero() {
+		if err := os.Chtimes(dst, timestamp, timestamp); err != nil {
+			return fmt.Errorf("failed to set file times: %w", err)
+		}
+	}
+	return nil
+}
 
+// copyFileWithTime copies a file from src to dst and sets its timestamp,
+// unless the timestamp is zero.
+func copyFileWithTime(src, dst string, timestamp time.Time) error {
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	if timestamp.IsZero() {
 		return nil
-	})
+	}
+	if err := os.Chtimes(dst, timestamp, timestamp); err != nil {
+		return fmt.Errorf("failed to set file times: %w", err)
+	}
+	return nil
 }
 
 // copyFile copies a file from src to dst using a temporary file for atomicity.
@@ -2,8 +2,11 @@ package core
 
 import (
 	"crypto/sha256"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -208,7 +211,7 @@ func TestCopyFileWithHash_Errors(t *testing.T) {
 }
 
 func TestMaterialize(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	tmpDir := t.TempDir()
 
@@ -254,7 +257,7 @@ func TestMaterialize(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -265,7 +268,7 @@ func TestMaterialize(t *testing.T) {
 	// Materialize the index
 	outputDir := filepath.Join(tmpDir, "output")
 	logger := hclog.NewNullLogger()
-	err := Materialize(logger, "test-index", outputDir)
+	err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{})
 	if err != nil {
 		t.Fatalf("Materialize() error = %v", err)
 	}
@@ -290,6 +293,7 @@ func TestMaterialize(t *testing.T) {
 }
 
 func TestMaterialize_Errors(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
 	tests := []struct {
@@ -314,7 +318,7 @@ func TestMaterialize_Errors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := Materialize(logger, tt.indexName, tt.rootPath)
+			err := Materialize(logger, dbPath, tt.indexName, tt.rootPath, MaterializeOptions{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Materialize() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -323,7 +327,7 @@ func TestMaterialize_Errors(t *testing.T) {
 }
 
 func TestMaterialize_WithAttachments(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	tmpDir := t.TempDir()
 
@@ -359,7 +363,7 @@ func TestMaterialize_WithAttachments(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -370,7 +374,7 @@ func TestMaterialize_WithAttachments(t *testing.T) {
 	// Materialize
 	outputDir := filepath.Join(tmpDir, "output")
 	logger := hclog.NewNullLogger()
-	err := Materialize(logger, "test-index", outputDir)
+	err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{})
 	if err != nil {
 		t.Fatalf("Materialize() error = %v", err)
 	}
@@ -382,7 +386,7 @@ func TestMaterialize_WithAttachments(t *testing.T) {
 }
 
 func TestMaterialize_SkipExisting(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	tmpDir := t.TempDir()
 
@@ -410,7 +414,7 @@ func TestMaterialize_SkipExisting(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -421,14 +425,313 @@ func TestMaterialize_SkipExisting(t *testing.T) {
 	// First materialization
 	outputDir := filepath.Join(tmpDir, "output")
 	logger := hclog.NewNullLogger()
-	err := Materialize(logger, "test-index", outputDir)
+	err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{})
 	if err != nil {
 		t.Fatalf("first Materialize() error = %v", err)
 	}
 
 	// Second materialization (should skip existing files)
-	err = Materialize(logger, "test-index", outputDir)
+	err = Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{})
 	if err != nil {
 		t.Fatalf("second Materialize() error = %v", err)
 	}
 }
+
+func TestMaterialize_Layout(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	taken := time.Date(2020, 2, 3, 12, 0, 0, 0, time.Local)
+
+	// Two different files with the same name land in the same date folder
+	indexData := make(map[string]*indexEntry)
+	for _, name := range []string{"a/IMG.jpg", "b/IMG.jpg"} {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		content := []byte("photo " + name)
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		hash := sha256.Sum256(content)
+		indexData[string(hash[:])] = &indexEntry{
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{},
+			Size:        int64(len(content)),
+			Timestamp:   taken,
+		}
+	}
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", indexData)
+	}()
+
+	logger := hclog.NewNullLogger()
+	for _, spec := range []string{"date", "original"} {
+		layout, err := ParseLayout(spec)
+		if err != nil {
+			t.Fatalf("ParseLayout() error = %v", err)
+		}
+
+		outputDir := filepath.Join(tmpDir, "output-"+spec)
+		var first []string
+		for run := 0; run < 2; run++ {
+			if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{Layout: layout}); err != nil {
+				t.Fatalf("Materialize() error = %v", err)
+			}
+
+			var files []string
+			err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() && info.Name() != materializeManifestName {
+					rel, _ := filepath.Rel(outputDir, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("failed to walk output: %v", err)
+			}
+			if len(files) != 2 {
+				t.Fatalf("%s layout wrote %v, want 2 files", spec, files)
+			}
+			if run == 0 {
+				first = files
+			} else if files[0] != first[0] || files[1] != first[1] {
+				t.Errorf("%s layout re-run wrote %v, want %v", spec, files, first)
+			}
+		}
+
+		switch spec {
+		case "date":
+			if !strings.HasPrefix(first[0], "2020/02/03/IMG") || !strings.HasPrefix(first[1], "2020/02/03/IMG") {
+				t.Errorf("date layout wrote %v", first)
+			}
+		case "original":
+			if first[0] != "a/IMG.jpg" || first[1] != "b/IMG.jpg" {
+				t.Errorf("original layout wrote %v", first)
+			}
+		}
+	}
+}
+
+func TestMaterialize_ReassignedName(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	taken := time.Date(2020, 2, 3, 12, 0, 0, 0, time.Local)
+
+	// Two files with the same name share a date folder, so one of them gets
+	// a collision suffix
+	entries := make(map[string]*indexEntry)
+	var hashes []string
+	for _, name := range []string{"a/IMG.jpg", "b/IMG.jpg"} {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		content := []byte("photo " + name)
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		hash := sha256.Sum256(content)
+		entries[string(hash[:])] = &indexEntry{
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{},
+			Size:        int64(len(content)),
+			Timestamp:   taken,
+		}
+		hashes = append(hashes, string(hash[:]))
+	}
+	sort.Strings(hashes)
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "both", entries)
+		// Without the first hash, the second one takes the unsuffixed name
+		createTestIndex(t, db, "second", map[string]*indexEntry{hashes[1]: entries[hashes[1]]})
+	}()
+
+	logger := hclog.NewNullLogger()
+	layout, err := ParseLayout("date")
+	if err != nil {
+		t.Fatalf("ParseLayout() error = %v", err)
+	}
+	outputDir := filepath.Join(tmpDir, "output")
+	for _, index := range []string{"both", "second"} {
+		if err := Materialize(logger, dbPath, index, outputDir, MaterializeOptions{Layout: layout}); err != nil {
+			t.Fatalf("Materialize(%s) error = %v", index, err)
+		}
+	}
+
+	got, err := hashFile(filepath.Join(outputDir, "2020", "02", "03", "IMG.jpg"))
+	if err != nil {
+		t.Fatalf("hashFile() error = %v", err)
+	}
+	if string(got) != hashes[1] {
+		t.Errorf("IMG.jpg has hash %x, want %x", got, hashes[1])
+	}
+}
+
+func TestMaterialize_LinkModes(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	fileContent := []byte("linked content")
+	filePath := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(filePath, fileContent, 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	hash := sha256.Sum256(fileContent)
+	timestamp := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", map[string]*indexEntry{
+			string(hash[:]): {
+				Paths:       map[string]struct{}{filePath: {}},
+				Attachments: map[string]string{},
+				Size:        int64(len(fileContent)),
+				Timestamp:   timestamp,
+			},
+		})
+	}()
+
+	logger := hclog.NewNullLogger()
+	for _, mode := range []LinkMode{LinkCopy, LinkHardlink, LinkReflink, LinkSymlink} {
+		t.Run(string(mode), func(t *testing.T) {
+			outputDir := filepath.Join(tmpDir, "output-"+string(mode))
+			if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{Link: mode}); err != nil {
+				t.Fatalf("Materialize() error = %v", err)
+			}
+
+			dst := filepath.Join(outputDir, fmt.Sprintf("%02x", hash[0]), fmt.Sprintf("%02x", hash[1]), fmt.Sprintf("%x.txt", hash))
+			got, err := os.ReadFile(dst)
+			if err != nil || string(got) != string(fileContent) {
+				t.Fatalf("materialized content = %q, %v", got, err)
+			}
+
+			srcInfo, _ := os.Stat(filePath)
+			dstInfo, _ := os.Lstat(dst)
+			switch mode {
+			case LinkHardlink:
+				if !os.SameFile(srcInfo, dstInfo) {
+					t.Error("destination is not a hard link to the source")
+				}
+			case LinkSymlink:
+				if dstInfo.Mode()&os.ModeSymlink == 0 {
+					t.Error("destination is not a symlink")
+				}
+			default:
+				// Reflinks fall back to a copy where they aren't supported
+				if os.SameFile(srcInfo, dstInfo) {
+					t.Error("destination shares the source's inode")
+				}
+				if !dstInfo.ModTime().Equal(timestamp) {
+					t.Errorf("destination mtime = %v, want %v", dstInfo.ModTime(), timestamp)
+				}
+			}
+		})
+	}
+
+	// Verification catches a stale source unless it is turned off
+	if err := os.WriteFile(filePath, []byte("edited since indexing"), 0644); err != nil {
+		t.Fatalf("failed to edit test file: %v", err)
+	}
+	if err := Materialize(logger, dbPath, "test-index", filepath.Join(tmpDir, "stale"), MaterializeOptions{Link: LinkHardlink}); err == nil {
+		t.Error("Materialize() of a stale source should fail")
+	}
+	if err := Materialize(logger, dbPath, "test-index", filepath.Join(tmpDir, "stale"), MaterializeOptions{Link: LinkHardlink, NoVerify: true}); err != nil {
+		t.Errorf("Materialize() with NoVerify error = %v", err)
+	}
+}
+
+func TestMaterialize_Resume(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	indexData := make(map[string]*indexEntry)
+	dsts := make(map[string]string)
+	outputDir := filepath.Join(tmpDir, "output")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		filePath := filepath.Join(tmpDir, name)
+		content := []byte("content of " + name)
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		hash := sha256.Sum256(content)
+		indexData[string(hash[:])] = &indexEntry{
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{},
+			Size:        int64(len(content)),
+			Timestamp:   time.Now(),
+		}
+		dsts[name] = filepath.Join(outputDir, fmt.Sprintf("%02x", hash[0]), fmt.Sprintf("%02x", hash[1]), fmt.Sprintf("%x.txt", hash))
+	}
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", indexData)
+	}()
+
+	// A stale source fails without stopping the other files
+	stale := filepath.Join(tmpDir, "c.txt")
+	if err := os.WriteFile(stale, []byte("edited since indexing"), 0644); err != nil {
+		t.Fatalf("failed to edit test file: %v", err)
+	}
+	logger := hclog.NewNullLogger()
+	opts := MaterializeOptions{Workers: 2}
+	if err := Materialize(logger, dbPath, "test-index", outputDir, opts); err == nil {
+		t.Fatal("Materialize() with a stale source should fail")
+	}
+	for name, dst := range dsts {
+		_, err := os.Stat(dst)
+		if got := err == nil; got != (name != "c.txt") {
+			t.Errorf("%s materialized = %v", name, got)
+		}
+	}
+
+	// Resuming trusts the checkpoint, so a finished file removed since isn't
+	// placed again
+	if err := os.WriteFile(stale, []byte("content of c.txt"), 0644); err != nil {
+		t.Fatalf("failed to restore test file: %v", err)
+	}
+	if err := os.Remove(dsts["a.txt"]); err != nil {
+		t.Fatalf("failed to remove destination: %v", err)
+	}
+	opts.Resume = true
+	if err := Materialize(logger, dbPath, "test-index", outputDir, opts); err != nil {
+		t.Fatalf("resumed Materialize() error = %v", err)
+	}
+	if _, err := os.Stat(dsts["c.txt"]); err != nil {
+		t.Errorf("resumed run did not place c.txt: %v", err)
+	}
+	if _, err := os.Stat(dsts["a.txt"]); !os.IsNotExist(err) {
+		t.Errorf("resumed run placed finished file a.txt again: %v", err)
+	}
+
+	// The checkpoint is cleared once a run completes
+	if err := Materialize(logger, dbPath, "test-index", outputDir, opts); err != nil {
+		t.Fatalf("second resumed Materialize() error = %v", err)
+	}
+	if _, err := os.Stat(dsts["a.txt"]); err != nil {
+		t.Errorf("run after a completed run did not place a.txt: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Verify statuses for materialized trees, in addition to the ones shared with
+// index verification.
+const (
+	VerifyCorrupt            = "corrupt"
+	VerifyExtra              = "extra"
+	VerifyOrphanedAttachment = "orphaned_attachment"
+)
+
+// materializedAttachmentExt is the extension of the attachments picked up
+// when indexing a materialized tree, which are the metadata files that come
+// with Google Photos takeouts.
+const materializedAttachmentExt = ".json"
+
+// MaterializedVerifyOptions controls how a materialized tree is checked.
+type MaterializedVerifyOptions struct {
+	// Layout is the layout the tree was materialized with. The zero value
+	// uses HashLayout.
+	Layout Layout
+
+	// Workers is the number of files to hash in parallel. Zero or less uses
+	// one worker per CPU.
+	Workers int
+}
+
+// expectedFile is a file that should be in a materialized tree.
+type expectedFile struct {
+	hash []byte
+	// owner is the planned file an attachment belongs to, or "" for a file.
+	owner string
+	seen  bool
+}
+
+// treeHashJob is a file in a materialized tree whose content is checked
+// against a hash.
+type treeHashJob struct {
+	path string
+	hash []byte
+	// inIndex is false for a file that isn't planned but whose name looks
+	// like a hash, which is checked against its name.
+	inIndex bool
+}
+
+// MaterializedVerify checks a materialized tree against the index it was made
+// from, without needing the original files. Every file the index plans for
+// the tree is re-hashed, and the report lists corrupt files, planned files
+// that are missing, files that don't belong, and attachments without their
+// file. Unplanned files named like a hash are checked against their name. It
+// returns an error wrapping ErrVerifyFailed if any problems were found.
+func MaterializedVerify(logger hclog.Logger, dbPath, indexName, rootPath string, opts MaterializedVerifyOptions, format OutputFormat) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if rootPath == "" {
+		return errors.New("root path cannot be empty")
+	}
+
+	problems, checked, err := checkMaterializedTree(logger, dbPath, indexName, rootPath, opts)
+	if err != nil {
+		return err
+	}
+
+	counts, err := writeVerifyProblems(problems, format)
+	if err != nil {
+		return err
+	}
+	if format == FormatTable {
+		fmt.Println()
+		fmt.Printf("%d files checked: %d corrupt, %d missing, %d extra, %d orphaned attachments, %d unreadable\n",
+			checked, counts[VerifyCorrupt], counts[VerifyMissing], counts[VerifyExtra],
+			counts[VerifyOrphanedAttachment], counts[VerifyUnreadable])
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d problems in %q", ErrVerifyFailed, len(problems), rootPath)
+	}
+	return nil
+}
+
+// checkMaterializedTree walks a materialized tree and returns its problems
+// sorted by path, along with the number of files it found.
+func checkMaterializedTree(logger hclog.Logger, dbPath, indexName, rootPath string, opts MaterializedVerifyOptions) ([]verifyProblem, int, error) {
+	if opts.Layout.parts == nil {
+		opts.Layout = HashLayout
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, err := planMaterialize(db, indexName, opts.Layout)
+	db.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	expected := make(map[string]*expectedFile)
+	bases := make(map[string]string)
+	for _, item := range items {
+		dst := filepath.Join(rootPath, item.dst)
+		expected[dst] = &expectedFile{hash: item.hash}
+		bases[strings.TrimSuffix(dst, fileExt(dst))] = dst
+		for ext := range item.entry.Attachments {
+			expected[attachmentPath(dst, ext)] = &expectedFile{hash: item.hash, owner: dst}
+		}
+	}
+
+	var (
+		problems []verifyProblem
+		jobs     []treeHashJob
+		checked  int
+	)
+	err = filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == filepath.Join(rootPath, materializeManifestName) {
+			return nil
+		}
+		checked++
+
+		if e, ok := expected[path]; ok {
+			e.seen = true
+			if e.owner == "" {
+				jobs = append(jobs, treeHashJob{path: path, hash: e.hash, inIndex: true})
+			}
+			return nil
+		}
+
+		// Anything else doesn't belong, but some of it is worth a closer look
+		problem := verifyProblem{Status: VerifyExtra, Path: path, Detail: "not in the index"}
+		name := d.Name()
+		owner := bases[strings.TrimSuffix(path, fileExt(path))]
+		switch {
+		case strings.HasPrefix(name, tmpFilePrefix):
+			problem.Detail = "temporary file left by a crashed run"
+		case owner != "":
+			problem.Status = VerifyOrphanedAttachment
+			problem.SHA256 = hex.EncodeToString(expected[owner].hash)
+			problem.Detail = "attachment of " + owner + " that the index doesn't have"
+		default:
+			if hash := hashFromName(name); hash != nil {
+				jobs = append(jobs, treeHashJob{path: path, hash: hash})
+				return nil
+			}
+		}
+		problems = append(problems, problem)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to walk %q: %w", rootPath, err)
+	}
+
+	for path, e := range expected {
+		if e.seen {
+			if e.owner != "" && !expected[e.owner].seen {
+				problems = append(problems, verifyProblem{
+					Status: VerifyOrphanedAttachment,
+					Path:   path,
+					SHA256: hex.EncodeToString(e.hash),
+					Detail: "its file " + e.owner + " is missing",
+				})
+			}
+			continue
+		}
+		detail := ""
+		if e.owner != "" {
+			detail = "attachment of " + e.owner
+		}
+		problems = append(problems, verifyProblem{
+			Status: VerifyMissing,
+			Path:   path,
+			SHA256: hex.EncodeToString(e.hash),
+			Detail: detail,
+		})
+	}
+
+	problems = append(problems, checkInParallel(logger, jobs, workers, hashTreeFile)...)
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+
+	return problems, checked, nil
+}
+
+// hashTreeFile checks one file from a materialized tree, returning nil if it
+// matches.
+func hashTreeFile(job treeHashJob) *verifyProblem {
+	problem := &verifyProblem{Path: job.path, SHA256: hex.EncodeToString(job.hash)}
+
+	hash, err := hashFile(job.path)
+	if err != nil {
+		problem.Status = VerifyUnreadable
+		problem.Detail = err.Error()
+		return problem
+	}
+
+	switch {
+	case !job.inIndex && bytes.Equal(hash, job.hash):
+		problem.Status = VerifyExtra
+		problem.Detail = "not in the index"
+	case !job.inIndex:
+		problem.Status = VerifyCorrupt
+		problem.Detail = "not in the index, and content has hash " + hex.EncodeToString(hash)
+	case !bytes.Equal(hash, job.hash):
+		problem.Status = VerifyCorrupt
+		problem.Detail = "content has hash " + hex.EncodeToString(hash)
+	default:
+		return nil
+	}
+	return problem
+}
+
+// hashFromName returns the hash a materialized file is named by, or nil if its
+// name isn't a SHA-256 hash with an optional extension.
+func hashFromName(name string) []byte {
+	hash, err := hex.DecodeString(strings.TrimSuffix(name, fileExt(name)))
+	if err != nil || len(hash) != sha256.Size {
+		return nil
+	}
+	return hash
+}
+
+// IndexAddMaterialized indexes a tree written by Materialize, taking each
+// file's hash from its <hash><ext> name instead of reading the whole file, so
+// old backups can be indexed quickly. A <hash>.json file next to a file with
+// the same hash is added as its attachment. Files that aren't named by a hash
+// are skipped. With verify set every file is re-hashed, and files whose
+// content doesn't match their name are skipped with a warning.
+func IndexAddMaterialized(logger hclog.Logger, dbPath, indexName, rootPath string, verify bool, opts IndexAddOptions) error {
+	// A file trusted on an earlier run would otherwise look unchanged
+	if verify {
+		opts.Rehash = true
+	}
+	_, err := indexAdd(logger, dbPath, indexMaterializedFile(verify), indexName, rootPath, opts)
+	return err
+}
+
+// indexMaterializedFile returns the indexFn for files in a materialized tree.
+func indexMaterializedFile(verify bool) indexFn {
+	return func(logger hclog.Logger, path string, info os.FileInfo) (*indexedFile, error) {
+		name := filepath.Base(path)
+		if name == materializeManifestName || strings.HasPrefix(name, tmpFilePrefix) {
+			return nil, nil
+		}
+		hash := hashFromName(name)
+		if hash == nil {
+			logger.Warn("skipping file that isn't named by its hash", "path", path)
+			return nil, nil
+		}
+
+		// Attachments are added with the file they belong to
+		attachment := strings.TrimSuffix(path, fileExt(path)) + materializedAttachmentExt
+		if path == attachment {
+			owned, err := hasMaterializedCompanion(path)
+			if err != nil {
+				return nil, err
+			}
+			if owned {
+				logger.Debug("skipping attachment with companion", "path", path)
+				return nil, nil
+			}
+		}
+
+		var entry *indexEntry
+		if verify {
+			actual, e, err := makeFileEntry(logger, path, info)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(actual, hash) {
+				logger.Warn("skipping file whose content doesn't match its name", "path", path, "hash", hex.EncodeToString(actual))
+				return nil, nil
+			}
+			entry = e
+		} else {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file: %w", err)
+			}
+			contentType, err := detectContentType(logger, f, info)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to detect content type: %w", err)
+			}
+			entry = &indexEntry{
+				Paths:       map[string]struct{}{path: {}},
+				Attachments: make(map[string]string),
+				Size:        info.Size(),
+				Timestamp:   info.ModTime(),
+				ContentType: contentType,
+			}
+		}
+
+		if path != attachment {
+			if _, err := os.Stat(attachment); err == nil {
+				entry.Attachments[materializedAttachmentExt] = attachment
+			}
+		}
+		return &indexedFile{hash: hash, entry: entry}, nil
+	}
+}
+
+// hasMaterializedCompanion reports whether another file in the same folder is
+// named by the same hash, which makes path its attachment.
+func hasMaterializedCompanion(path string) (bool, error) {
+	name := filepath.Base(path)
+	base := strings.TrimSuffix(name, fileExt(name))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return false, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if n != name && !e.IsDir() && strings.TrimSuffix(n, fileExt(n)) == base {
+			return true, nil
+		}
+	}
+	return false, nil
+}
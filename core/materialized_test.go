@@ -0,0 +1,222 @@
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMaterializedVerify(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "output")
+	indexData := make(map[string]*indexEntry)
+	dsts := make(map[string]string)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		filePath := filepath.Join(tmpDir, name)
+		content := []byte("content of " + name)
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		hash := sha256.Sum256(content)
+		indexData[string(hash[:])] = &indexEntry{
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{},
+			Size:        int64(len(content)),
+			Timestamp:   time.Now(),
+		}
+		dsts[name] = filepath.Join(outputDir, fmt.Sprintf("%02x", hash[0]), fmt.Sprintf("%02x", hash[1]), fmt.Sprintf("%x.txt", hash))
+	}
+	jsonPath := filepath.Join(tmpDir, "b.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"title": "b"}`), 0644); err != nil {
+		t.Fatalf("failed to create attachment: %v", err)
+	}
+	bHash := sha256.Sum256([]byte("content of b.txt"))
+	indexData[string(bHash[:])].Attachments[".json"] = jsonPath
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", indexData)
+	}()
+
+	logger := hclog.NewNullLogger()
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+	if err := MaterializedVerify(logger, dbPath, "test-index", outputDir, MaterializedVerifyOptions{}, FormatTable); err != nil {
+		t.Fatalf("MaterializedVerify() of a fresh tree error = %v", err)
+	}
+
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	// Rot one file, lose another but keep its attachment, and leave behind
+	// files that don't belong
+	write(dsts["a.txt"], "bit rot")
+	if err := os.Remove(dsts["b.txt"]); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	bJSON := attachmentPath(dsts["b.txt"], ".json")
+	aXMP := attachmentPath(dsts["a.txt"], ".xmp")
+	write(aXMP, "<xmp/>")
+	extra := filepath.Join(outputDir, "extra.txt")
+	write(extra, "not in the index")
+	tmp := filepath.Join(outputDir, ".venn-tmp-123")
+	write(tmp, "partial copy")
+	unknown := sha256.Sum256([]byte("unknown"))
+	hashNamed := filepath.Join(outputDir, "aa", "bb", fmt.Sprintf("%x.txt", unknown))
+	write(hashNamed, "unknown")
+	misnamed := filepath.Join(outputDir, "cc", "dd", fmt.Sprintf("%x.txt", bHash))
+	write(misnamed, "not what the name says")
+
+	problems, checked, err := checkMaterializedTree(logger, dbPath, "test-index", outputDir, MaterializedVerifyOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("checkMaterializedTree() error = %v", err)
+	}
+	if checked != 7 {
+		t.Errorf("checked = %d, want 7", checked)
+	}
+
+	want := map[string]string{
+		dsts["a.txt"]: VerifyCorrupt,
+		dsts["b.txt"]: VerifyMissing,
+		bJSON:         VerifyOrphanedAttachment,
+		aXMP:          VerifyOrphanedAttachment,
+		extra:         VerifyExtra,
+		tmp:           VerifyExtra,
+		hashNamed:     VerifyExtra,
+		misnamed:      VerifyCorrupt,
+	}
+	got := make(map[string]string)
+	for _, p := range problems {
+		got[p.Path] = p.Status
+	}
+	for path, status := range want {
+		if got[path] != status {
+			t.Errorf("%s status = %q, want %q", path, got[path], status)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d problems, want %d: %+v", len(got), len(want), problems)
+	}
+
+	err = MaterializedVerify(logger, dbPath, "test-index", outputDir, MaterializedVerifyOptions{}, FormatJSONL)
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("MaterializedVerify() error = %v, want ErrVerifyFailed", err)
+	}
+}
+
+func TestMaterializedVerify_Errors(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	logger := hclog.NewNullLogger()
+
+	if err := MaterializedVerify(logger, dbPath, "", t.TempDir(), MaterializedVerifyOptions{}, FormatTable); err == nil {
+		t.Error("expected error for empty index name")
+	}
+	if err := MaterializedVerify(logger, dbPath, "test-index", "", MaterializedVerifyOptions{}, FormatTable); err == nil {
+		t.Error("expected error for empty root path")
+	}
+	if err := MaterializedVerify(logger, dbPath, "missing-index", t.TempDir(), MaterializedVerifyOptions{}, FormatTable); err == nil {
+		t.Error("expected error for missing index")
+	}
+}
+
+func TestIndexAddMaterialized(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	timestamp := mustParseTime(t, "2019-07-04T12:00:00Z")
+	_, names := setupArchiveIndex(t, dbPath, tmpDir, timestamp)
+	outputDir := filepath.Join(tmpDir, "output")
+
+	logger := hclog.NewNullLogger()
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+
+	// A stray file that isn't named by its hash is skipped
+	if err := os.WriteFile(filepath.Join(outputDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := IndexAddMaterialized(logger, dbPath, "restored", outputDir, false, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddMaterialized() error = %v", err)
+	}
+
+	var photo, attachment string
+	for name := range names {
+		switch filepath.Ext(name) {
+		case ".jpg":
+			photo = filepath.Join(outputDir, filepath.FromSlash(name))
+		case ".json":
+			attachment = filepath.Join(outputDir, filepath.FromSlash(name))
+		}
+	}
+	hash := sha256.Sum256([]byte("photo content"))
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if n := entryCount(t, db, "restored"); n != 1 {
+		t.Errorf("restored index has %d entries, want 1", n)
+	}
+	var entry *indexEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "restored", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		entry, err = getEntry(bucket, hash[:])
+		return err
+	})
+	db.Close()
+	if err != nil || entry == nil {
+		t.Fatalf("failed to read restored entry: %v", err)
+	}
+	if _, ok := entry.Paths[photo]; !ok || len(entry.Paths) != 1 {
+		t.Errorf("Paths = %v, want only %s", entry.Paths, photo)
+	}
+	if got := entry.Attachments[".json"]; got != attachment {
+		t.Errorf("attachment = %q, want %q", got, attachment)
+	}
+	if entry.Size != int64(len("photo content")) {
+		t.Errorf("Size = %d, want %d", entry.Size, len("photo content"))
+	}
+	if !entry.Timestamp.Equal(timestamp) {
+		t.Errorf("Timestamp = %v, want %v", entry.Timestamp, timestamp)
+	}
+
+	// Verifying catches content that no longer matches its name
+	if err := os.WriteFile(photo, []byte("bit rot"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := IndexAddMaterialized(logger, dbPath, "verified", outputDir, true, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddMaterialized() with verify error = %v", err)
+	}
+	if paths := indexedPaths(t, dbPath, "verified", hash[:]); len(paths) != 0 {
+		t.Errorf("verified index has corrupt file: %v", paths)
+	}
+
+	if err := IndexAddMaterialized(logger, dbPath, "", outputDir, false, IndexAddOptions{}); err == nil {
+		t.Error("expected error for empty index name")
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryanuber/columnize"
+)
+
+// OutputFormat selects how commands print their results.
+type OutputFormat string
+
+const (
+	// FormatTable prints aligned columns for people to read.
+	FormatTable OutputFormat = "table"
+	// FormatJSON prints a single JSON document.
+	FormatJSON OutputFormat = "json"
+	// FormatJSONL prints one JSON object per line.
+	FormatJSONL OutputFormat = "jsonl"
+	// FormatCSV prints comma-separated values with a header row.
+	FormatCSV OutputFormat = "csv"
+)
+
+// ParseOutputFormat parses an output format name. An empty name selects the
+// table format.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch f := OutputFormat(s); f {
+	case "":
+		return FormatTable, nil
+	case FormatTable, FormatJSON, FormatJSONL, FormatCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want table, json, jsonl or csv)", s)
+}
+
+// entryJSON is the JSON representation of an index entry.
+type entryJSON struct {
+	SHA256      string            `json:"sha256"`
+	Size        int64             `json:"size"`
+	Timestamp   time.Time         `json:"timestamp"`
+	ContentType string            `json:"content_type"`
+	Paths       []string          `json:"paths"`
+	Attachments map[string]string `json:"attachments"`
+}
+
+// newEntryJSON converts an index entry for JSON output.
+func newEntryJSON(hash []byte, entry *indexEntry) entryJSON {
+	attachments := entry.Attachments
+	if attachments == nil {
+		attachments = map[string]string{}
+	}
+	return entryJSON{
+		SHA256:      hex.EncodeToString(hash),
+		Size:        entry.Size,
+		Timestamp:   entry.Timestamp,
+		ContentType: entry.ContentType,
+		Paths:       sortedPaths(entry),
+		Attachments: attachments,
+	}
+}
+
+// sortedPaths returns an entry's paths in sorted order for consistent output.
+func sortedPaths(entry *indexEntry) []string {
+	paths := make([]string, 0, len(entry.Paths))
+	for p := range entry.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// recordWriter writes a stream of records in one output format. Records are
+// written as they arrive, except for the table format which has to see every
+// row before it can align the columns.
+type recordWriter struct {
+	w      io.Writer
+	format OutputFormat
+	header []string
+
+	rows  []string // table rows, buffered until close
+	csv   *csv.Writer
+	count int
+}
+
+// newRecordWriter returns a writer for records with the given column header.
+// The header is used by the table and CSV formats.
+func newRecordWriter(w io.Writer, format OutputFormat, header []string) (*recordWriter, error) {
+	rw := &recordWriter{w: w, format: format, header: header}
+	switch format {
+	case FormatTable:
+		rw.rows = []string{strings.Join(header, "|")}
+	case FormatCSV:
+		rw.csv = csv.NewWriter(w)
+		if err := rw.csv.Write(header); err != nil {
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	case FormatJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return nil, err
+		}
+	case FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	return rw, nil
+}
+
+// write outputs one record. The object is used by the JSON formats, and each
+// element of rows is one line of the table and CSV formats.
+func (rw *recordWriter) write(object any, rows ...[]string) error {
+	switch rw.format {
+	case FormatTable:
+		for _, row := range rows {
+			rw.rows = append(rw.rows, strings.Join(row, "|"))
+		}
+	case FormatCSV:
+		for _, row := range rows {
+			if err := rw.csv.Write(row); err != nil {
+				return fmt.Errorf("failed to write CSV row: %w", err)
+			}
+		}
+	case FormatJSON:
+		data, err := json.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		sep := "\n"
+		if rw.count > 0 {
+			sep = ",\n"
+		}
+		if _, err := fmt.Fprintf(rw.w, "%s  %s", sep, data); err != nil {
+			return err
+		}
+	case FormatJSONL:
+		data, err := json.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		if _, err := fmt.Fprintf(rw.w, "%s\n", data); err != nil {
+			return err
+		}
+	}
+	rw.count++
+	return nil
+}
+
+// close finishes the output.
+func (rw *recordWriter) close() error {
+	switch rw.format {
+	case FormatTable:
+		_, err := fmt.Fprintln(rw.w, columnize.SimpleFormat(rw.rows))
+		return err
+	case FormatCSV:
+		rw.csv.Flush()
+		return rw.csv.Error()
+	case FormatJSON:
+		_, err := io.WriteString(rw.w, "\n]\n")
+		return err
+	}
+	return nil
+}
+
+// writeJSON writes a single value as a JSON document, indented for the JSON
+// format and on one line for JSON Lines.
+func writeJSON(w io.Writer, format OutputFormat, v any) error {
+	enc := json.NewEncoder(w)
+	if format == FormatJSON {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
+
+// entryRows returns the table and CSV rows for an entry. The table has one
+// row per entry with its paths joined by commas, while CSV has one row per
+// path so that paths containing commas survive.
+func entryRows(format OutputFormat, hash []byte, entry *indexEntry) [][]string {
+	paths := sortedPaths(entry)
+	fields := []string{
+		hex.EncodeToString(hash),
+		strconv.FormatInt(entry.Size, 10),
+		entry.Timestamp.Format(time.RFC3339),
+		entry.ContentType,
+	}
+
+	if format == FormatTable {
+		return [][]string{append(fields, strings.Join(paths, ","))}
+	}
+
+	exts := make([]string, 0, len(entry.Attachments))
+	for ext := range entry.Attachments {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	attachments := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		attachments = append(attachments, ext+"="+entry.Attachments[ext])
+	}
+
+	rows := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		row := append(append([]string{}, fields...), p, strings.Join(attachments, ";"))
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    OutputFormat
+		wantErr bool
+	}{
+		{"", FormatTable, false},
+		{"table", FormatTable, false},
+		{"json", FormatJSON, false},
+		{"jsonl", FormatJSONL, false},
+		{"csv", FormatCSV, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseOutputFormat(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOutputFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseOutputFormat(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// writeTestEntries writes two entries through a recordWriter in the given
+// format and returns the output.
+func writeTestEntries(t *testing.T, format OutputFormat) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	header := []string{"sha256", "size", "timestamp", "content_type", "path", "attachments"}
+	out, err := newRecordWriter(&buf, format, header)
+	if err != nil {
+		t.Fatalf("newRecordWriter() error = %v", err)
+	}
+
+	for i, content := range []string{"one", "two"} {
+		hash := sha256.Sum256([]byte(content))
+		entry := &indexEntry{
+			Paths:       map[string]struct{}{"b/" + content: {}, "a,comma/" + content: {}},
+			Attachments: map[string]string{".json": content + ".json"},
+			Size:        int64(i + 1),
+			Timestamp:   mustParseTime(t, "2024-01-01T12:00:00Z"),
+			ContentType: "image/jpeg",
+		}
+		if err := out.write(newEntryJSON(hash[:], entry), entryRows(format, hash[:], entry)...); err != nil {
+			t.Fatalf("write() error = %v", err)
+		}
+	}
+
+	if err := out.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+	return buf.String()
+}
+
+func TestRecordWriter_JSON(t *testing.T) {
+	var entries []entryJSON
+	if err := json.Unmarshal([]byte(writeTestEntries(t, FormatJSON)), &entries); err != nil {
+		t.Fatalf("output is not a JSON array: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	hash := sha256.Sum256([]byte("one"))
+	got := entries[0]
+	if got.SHA256 != fmt.Sprintf("%x", hash) {
+		t.Errorf("SHA256 = %s, want full hash", got.SHA256)
+	}
+	if len(got.Paths) != 2 || got.Paths[0] != "a,comma/one" {
+		t.Errorf("Paths = %v, want both paths sorted", got.Paths)
+	}
+	if got.Attachments[".json"] != "one.json" {
+		t.Errorf("Attachments = %v, want .json attachment", got.Attachments)
+	}
+	if got.ContentType != "image/jpeg" || got.Size != 1 {
+		t.Errorf("entry = %+v, want size and content type", got)
+	}
+}
+
+func TestRecordWriter_JSONL(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(writeTestEntries(t, FormatJSONL)))
+	lines := 0
+	for scanner.Scan() {
+		var entry entryJSON
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v", lines+1, err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("got %d lines, want 2", lines)
+	}
+}
+
+func TestRecordWriter_CSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(writeTestEntries(t, FormatCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+
+	// Header plus one row per path
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+	if records[0][0] != "sha256" {
+		t.Errorf("header = %v", records[0])
+	}
+	if records[1][4] != "a,comma/one" || records[1][5] != ".json=one.json" {
+		t.Errorf("first row = %v", records[1])
+	}
+}
+
+func TestRecordWriter_Table(t *testing.T) {
+	out := writeTestEntries(t, FormatTable)
+	if lines := strings.Count(strings.TrimSpace(out), "\n") + 1; lines != 3 {
+		t.Errorf("got %d lines, want header and one line per entry:\n%s", lines, out)
+	}
+	if !strings.Contains(out, "a,comma/one,b/one") {
+		t.Errorf("table row missing joined paths:\n%s", out)
+	}
+}
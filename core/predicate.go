@@ -0,0 +1,458 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// entryPredicate decides whether an index entry is kept by index filter.
+type entryPredicate func(entry *indexEntry) bool
+
+// predicateToken is a lexical token in a predicate. The kind is a word, a
+// quoted string, a comparison operator, '(' or ')', or 0 at the end of the
+// input.
+type predicateToken struct {
+	kind rune
+	text string
+	pos  int
+}
+
+// Kinds of predicate tokens other than parentheses.
+const (
+	tokenWord     = 'w'
+	tokenString   = 's'
+	tokenOperator = 'o'
+)
+
+// predicateOperators are the comparison operators, longest first so that
+// "<=" isn't read as "<".
+var predicateOperators = []string{"==", "!=", "<=", ">=", "=", "<", ">", "~"}
+
+// tokenizePredicate splits a predicate into tokens. Words are runs of any
+// characters other than spaces, quotes, parentheses and operator characters,
+// so sizes, dates and most globs don't need quoting.
+func tokenizePredicate(input string) ([]predicateToken, error) {
+	var tokens []predicateToken
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(' || r == ')':
+			tokens = append(tokens, predicateToken{kind: r, text: string(r), pos: i})
+			i += size
+		case r == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			tokens = append(tokens, predicateToken{kind: tokenString, text: input[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case isOperatorRune(r):
+			op := ""
+			for _, o := range predicateOperators {
+				if strings.HasPrefix(input[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", r, i)
+			}
+			tokens = append(tokens, predicateToken{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(input) {
+				r, size := utf8.DecodeRuneInString(input[i:])
+				if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' || isOperatorRune(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, predicateToken{kind: tokenWord, text: input[start:i], pos: start})
+		}
+	}
+	return append(tokens, predicateToken{pos: len(input)}), nil
+}
+
+// isOperatorRune reports whether r starts a comparison operator.
+func isOperatorRune(r rune) bool {
+	return strings.ContainsRune("=!<>~", r)
+}
+
+// predicateParser is a recursive descent parser for predicates. "not" binds
+// tightest, then "and", then "or".
+type predicateParser struct {
+	tokens []predicateToken
+	pos    int
+}
+
+// parsePredicate parses a predicate over index entry fields, such as
+// `size > 1MB and content_type ~ "^image/"`.
+func parsePredicate(input string) (entryPredicate, error) {
+	tokens, err := tokenizePredicate(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &predicateParser{tokens: tokens}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return pred, nil
+}
+
+func (p *predicateParser) peek() predicateToken {
+	return p.tokens[p.pos]
+}
+
+func (p *predicateParser) next() predicateToken {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// peekKeyword reports whether the next token is the given keyword.
+func (p *predicateParser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// parseOr parses terms joined by "or".
+func (p *predicateParser) parseOr() (entryPredicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(entry *indexEntry) bool { return l(entry) || right(entry) }
+	}
+	return left, nil
+}
+
+// parseAnd parses factors joined by "and".
+func (p *predicateParser) parseAnd() (entryPredicate, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(entry *indexEntry) bool { return l(entry) && right(entry) }
+	}
+	return left, nil
+}
+
+// parseNot parses a test, a parenthesized predicate, or "not" followed by
+// either.
+func (p *predicateParser) parseNot() (entryPredicate, error) {
+	if p.peekKeyword("not") {
+		p.next()
+		pred, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(entry *indexEntry) bool { return !pred(entry) }, nil
+	}
+
+	t := p.next()
+	switch t.kind {
+	case '(':
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != ')' {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos)
+		}
+		return pred, nil
+	case tokenWord:
+		if p.peek().kind == '(' {
+			return p.parseCall(t)
+		}
+		return p.parseComparison(t)
+	case 0:
+		return nil, errors.New("predicate ended where a field or '(' was expected")
+	}
+	return nil, fmt.Errorf("expected a field or '(' at position %d, got %q", t.pos, t.text)
+}
+
+// parseCall parses a function test such as has_attachment(".json").
+func (p *predicateParser) parseCall(name predicateToken) (entryPredicate, error) {
+	if name.text != "has_attachment" {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	p.next()
+	arg := p.next()
+	if arg.kind != tokenWord && arg.kind != tokenString {
+		return nil, fmt.Errorf("expected an extension at position %d", arg.pos)
+	}
+	if closing := p.next(); closing.kind != ')' {
+		return nil, fmt.Errorf("missing ')' for %s at position %d", name.text, name.pos)
+	}
+
+	ext := arg.text
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return func(entry *indexEntry) bool {
+		_, ok := entry.Attachments[ext]
+		return ok
+	}, nil
+}
+
+// parseComparison parses a test of a field against a value.
+func (p *predicateParser) parseComparison(field predicateToken) (entryPredicate, error) {
+	op := p.next()
+	if op.kind != tokenOperator && !(op.kind == tokenWord && op.text == "glob") {
+		return nil, fmt.Errorf("expected an operator after %s at position %d", field.text, op.pos)
+	}
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, fmt.Errorf("expected a value after %s %s at position %d", field.text, op.text, value.pos)
+	}
+
+	pred, err := comparePredicate(field.text, op.text, value.text)
+	if err != nil {
+		return nil, fmt.Errorf("%w at position %d", err, field.pos)
+	}
+	return pred, nil
+}
+
+// comparePredicate returns the test for one comparison of a field.
+func comparePredicate(field, op, value string) (entryPredicate, error) {
+	var err error
+	switch field {
+	case "size":
+		n, err := ParseSize(value)
+		if err != nil {
+			return nil, err
+		}
+		return orderedPredicate(op, field, func(entry *indexEntry) int64 { return entry.Size }, n)
+
+	case "dup_count":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid count %q", value)
+		}
+		return orderedPredicate(op, field, func(entry *indexEntry) int64 { return int64(len(entry.Paths)) }, n)
+
+	case "timestamp":
+		t, err := parsePredicateTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return orderedPredicate(op, field, func(entry *indexEntry) int64 { return entry.Timestamp.UnixNano() }, t.UnixNano())
+
+	case "content_type":
+		var match func(string) bool
+		if op == "glob" {
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", value, err)
+			}
+			match = func(s string) bool {
+				ok, _ := path.Match(value, s)
+				return ok
+			}
+		} else if match, err = stringMatcher(op, field, value); err != nil {
+			return nil, err
+		}
+		return func(entry *indexEntry) bool { return match(entry.ContentType) }, nil
+
+	case "path":
+		// Matching any path makes "!=" ambiguous, so it's left to "not"
+		var match func(string) bool
+		if op == "glob" {
+			g, err := parseGlobPattern(value)
+			if err != nil {
+				return nil, err
+			}
+			match = func(p string) bool { return g.match(strings.TrimPrefix(p, "/"), false) }
+		} else if op == "!=" {
+			return nil, errors.New("operator \"!=\" is not supported for path, use not path = ...")
+		} else if match, err = stringMatcher(op, field, value); err != nil {
+			return nil, err
+		}
+		return func(entry *indexEntry) bool {
+			for p := range entry.Paths {
+				if match(p) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q", field)
+}
+
+// orderedPredicate compares a numeric field of an entry against a value.
+func orderedPredicate(op, field string, get func(*indexEntry) int64, value int64) (entryPredicate, error) {
+	var cmp func(a, b int64) bool
+	switch op {
+	case "=", "==":
+		cmp = func(a, b int64) bool { return a == b }
+	case "!=":
+		cmp = func(a, b int64) bool { return a != b }
+	case "<":
+		cmp = func(a, b int64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b int64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b int64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b int64) bool { return a >= b }
+	default:
+		return nil, fmt.Errorf("operator %q is not supported for %s", op, field)
+	}
+	return func(entry *indexEntry) bool { return cmp(get(entry), value) }, nil
+}
+
+// stringMatcher matches a string field against a value by equality or, with
+// "~", a regular expression.
+func stringMatcher(op, field, value string) (func(string) bool, error) {
+	switch op {
+	case "=", "==":
+		return func(s string) bool { return s == value }, nil
+	case "!=":
+		return func(s string) bool { return s != value }, nil
+	case "~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("operator %q is not supported for %s", op, field)
+}
+
+// parsePredicateTime parses a date, taken as midnight local time, or an
+// RFC 3339 timestamp.
+func parsePredicateTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+// IndexFilter creates a new index with the entries of a source index that
+// match every one of the given predicates, such as `size > 1MB` or
+// `path glob "**/DCIM/**"`. Matching entries are copied whole, and the source
+// index is not modified.
+func IndexFilter(logger hclog.Logger, dbPath, targetIndex, sourceIndex string, where []string) error {
+	if targetIndex == "" {
+		return errors.New("target index name cannot be empty")
+	}
+	if sourceIndex == "" {
+		return errors.New("source index name cannot be empty")
+	}
+	if len(where) == 0 {
+		return errors.New("at least one predicate is required")
+	}
+
+	var preds []entryPredicate
+	for _, w := range where {
+		if strings.TrimSpace(w) == "" {
+			return errors.New("predicate cannot be empty")
+		}
+		pred, err := parsePredicate(w)
+		if err != nil {
+			return fmt.Errorf("invalid predicate %q: %w", w, err)
+		}
+		preds = append(preds, pred)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		// A write transaction would quietly create a misspelled index
+		if !bucketExistsForIndex(tx, sourceIndex) {
+			return fmt.Errorf("index %q does not exist", sourceIndex)
+		}
+		if bucketExistsForIndex(tx, targetIndex) {
+			return fmt.Errorf("target index %q already exists", targetIndex)
+		}
+
+		sourceBucket, err := getBucketForIndex(tx, sourceIndex, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		targetBucket, err := getBucketForIndex(tx, targetIndex, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		count, total, err := filterEntries(sourceBucket, targetBucket, preds)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("index filter completed", "target", targetIndex, "source", sourceIndex, "entries", count, "of", total)
+		return nil
+	})
+}
+
+// filterEntries copies the entries of source that match every predicate to
+// target. Returns the number of entries copied and the number examined.
+func filterEntries(source, target *bolt.Bucket, preds []entryPredicate) (int, int, error) {
+	count, total := 0, 0
+	cursor := source.Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		total++
+		entry, err := decodeEntry(entryData)
+		if err != nil {
+			return count, total, fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		matched := true
+		for _, pred := range preds {
+			if !pred(entry) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if err := target.Put(hash, entryData); err != nil {
+			return count, total, fmt.Errorf("failed to put entry: %w", err)
+		}
+		count++
+	}
+	return count, total, nil
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParsePredicate(t *testing.T) {
+	entry := &indexEntry{
+		Paths: map[string]struct{}{
+			"/home/user/Pictures/DCIM/100APPLE/IMG_0001.JPG": {},
+			"/backup/photos/IMG_0001.JPG":                    {},
+		},
+		Attachments: map[string]string{".json": "/backup/photos/IMG_0001.JPG.json"},
+		Size:        3 << 20,
+		Timestamp:   time.Date(2014, 6, 1, 12, 0, 0, 0, time.Local),
+		ContentType: "image/jpeg",
+	}
+
+	tests := []struct {
+		input   string
+		want    bool
+		wantErr bool
+	}{
+		{"size > 1MB", true, false},
+		{"size <= 3MB", true, false},
+		{"size < 1.5 GB", false, true},
+		{`size < "1.5 GB"`, true, false},
+		{"size != 3145728", false, false},
+		{`content_type ~ "image/"`, true, false},
+		{`content_type ~ "^video/"`, false, false},
+		{"content_type = image/jpeg", true, false},
+		{"content_type glob image/*", true, false},
+		{"content_type > image", false, true},
+		{"timestamp < 2015-01-01", true, false},
+		{"timestamp >= 2014-06-01", true, false},
+		{"timestamp > 2014-06-02", false, false},
+		{"timestamp < 2020-01-01T00:00:00Z", true, false},
+		{"timestamp < yesterday", false, true},
+		{`path glob "**/DCIM/**"`, true, false},
+		{"path glob *.JPG", true, false},
+		{"path glob /backup/*", false, false},
+		{"path glob /backup/**", true, false},
+		{`path ~ "^/backup/"`, true, false},
+		{"path = /backup/photos/IMG_0001.JPG", true, false},
+		{"path != /backup/photos/IMG_0001.JPG", false, true},
+		{"dup_count >= 2", true, false},
+		{"dup_count > 2", false, false},
+		{"dup_count = two", false, true},
+		{`has_attachment(".json")`, true, false},
+		{"has_attachment(json)", true, false},
+		{`has_attachment(".xmp")`, false, false},
+		{`has_extension(".json")`, false, true},
+		{"size > 1MB and dup_count > 2", false, false},
+		{"size > 1MB and dup_count > 2 or has_attachment(.json)", true, false},
+		{"size > 1MB and (dup_count > 2 or not has_attachment(.json))", false, false},
+		{"not not size > 1MB", true, false},
+		{"NOT size > 1MB", false, false},
+		{"", false, true},
+		{"size", false, true},
+		{"size >", false, true},
+		{"size > 1MB and", false, true},
+		{"(size > 1MB", false, true},
+		{"size > 1MB)", false, true},
+		{"color = red", false, true},
+		{"size ! 1MB", false, true},
+		{`path glob "**/DCIM`, false, true},
+		{`content_type ~ "("`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pred, err := parsePredicate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePredicate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && pred(entry) != tt.want {
+				t.Errorf("parsePredicate(%q) matched = %v, want %v", tt.input, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexFilter(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	entry := func(size int64, contentType string, paths ...string) *indexEntry {
+		e := &indexEntry{
+			Paths:       map[string]struct{}{},
+			Attachments: map[string]string{},
+			Size:        size,
+			Timestamp:   time.Now(),
+			ContentType: contentType,
+		}
+		for _, p := range paths {
+			e.Paths[p] = struct{}{}
+		}
+		return e
+	}
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "all", map[string]*indexEntry{
+			"photo": entry(2<<20, "image/jpeg", "/phone/DCIM/a.jpg", "/backup/a.jpg"),
+			"thumb": entry(10<<10, "image/png", "/phone/DCIM/thumb.png"),
+			"movie": entry(50<<20, "video/mp4", "/phone/Movies/b.mp4"),
+			"notes": entry(100, "text/plain", "/docs/notes.txt"),
+		})
+	}()
+
+	logger := hclog.NewNullLogger()
+	tests := []struct {
+		target string
+		where  []string
+		want   []string
+	}{
+		{"images", []string{`content_type ~ "^image/"`}, []string{"photo", "thumb"}},
+		{"big_images", []string{`content_type ~ "^image/"`, "size > 1MB"}, []string{"photo"}},
+		{"camera", []string{`path glob "**/DCIM/**"`}, []string{"photo", "thumb"}},
+		{"dupes", []string{"dup_count >= 2"}, []string{"photo"}},
+		{"not_phone", []string{`not path glob "/phone/**"`}, []string{"notes"}},
+		{"none", []string{"size > 1TB"}, nil},
+	}
+	for _, tt := range tests {
+		if err := IndexFilter(logger, dbPath, tt.target, "all", tt.where); err != nil {
+			t.Fatalf("IndexFilter(%q) error = %v", tt.where, err)
+		}
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	for _, tt := range tests {
+		err := db.View(func(tx *bolt.Tx) error {
+			bucket, err := getBucketForIndex(tx, tt.target, hashesBucketKey)
+			if err != nil {
+				return err
+			}
+			if n := bucket.Stats().KeyN; n != len(tt.want) {
+				t.Errorf("%s has %d entries, want %d", tt.target, n, len(tt.want))
+			}
+			for _, hash := range tt.want {
+				e, err := getEntry(bucket, []byte(hash))
+				if err != nil {
+					return err
+				}
+				if e == nil {
+					t.Errorf("%s missing %s", tt.target, hash)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("verification error = %v", err)
+		}
+	}
+	if n := entryCount(t, db, "all"); n != 4 {
+		t.Errorf("source has %d entries, want 4", n)
+	}
+	db.Close()
+
+	// Errors leave no trace of the target or a misspelled source
+	if err := IndexFilter(logger, dbPath, "images", "all", []string{"size > 0"}); err == nil {
+		t.Error("IndexFilter into an existing index should fail")
+	}
+	if err := IndexFilter(logger, dbPath, "typo", "alll", []string{"size > 0"}); err == nil {
+		t.Error("IndexFilter from a missing index should fail")
+	}
+	if err := IndexFilter(logger, dbPath, "bad", "all", []string{"size >"}); err == nil {
+		t.Error("IndexFilter with an invalid predicate should fail")
+	}
+	if err := IndexFilter(logger, dbPath, "bad", "all", nil); err == nil {
+		t.Error("IndexFilter without a predicate should fail")
+	}
+
+	db, err = getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{"typo", "alll", "bad"} {
+			if bucketExistsForIndex(tx, name) {
+				t.Errorf("index %q should not exist", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
@@ -0,0 +1,537 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// quarantineManifestName is the manifest written inside a quarantine
+	// directory when no other manifest path is given.
+	quarantineManifestName = "venn-manifest.jsonl"
+	quarantineFileMode     = 0600
+)
+
+// KeepPolicy picks which copy of a duplicated file is kept by a prune.
+type KeepPolicy struct {
+	kind   string
+	prefix string
+	re     *regexp.Regexp
+}
+
+// ParseKeepPolicy parses a keeper policy: "shortest" keeps the shortest path,
+// "oldest" keeps the file with the oldest modification time, "prefix:<path>"
+// keeps a file under the given path, and "regex:<expr>" keeps a file whose
+// path matches the regular expression. Remaining ties go to the first path in
+// sorted order.
+func ParseKeepPolicy(s string) (KeepPolicy, error) {
+	kind, arg, _ := strings.Cut(s, ":")
+	switch kind {
+	case "shortest", "oldest":
+		if arg != "" {
+			break
+		}
+		return KeepPolicy{kind: kind}, nil
+	case "prefix":
+		if arg == "" {
+			return KeepPolicy{}, errors.New("prefix policy needs a path")
+		}
+		return KeepPolicy{kind: kind, prefix: filepath.Clean(arg)}, nil
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return KeepPolicy{}, fmt.Errorf("invalid regex policy: %w", err)
+		}
+		return KeepPolicy{kind: kind, re: re}, nil
+	}
+	return KeepPolicy{}, fmt.Errorf("unknown keep policy %q (want shortest, oldest, prefix:<path> or regex:<expr>)", s)
+}
+
+// String returns the policy in the form accepted by ParseKeepPolicy.
+func (p KeepPolicy) String() string {
+	switch p.kind {
+	case "prefix":
+		return "prefix:" + p.prefix
+	case "regex":
+		return "regex:" + p.re.String()
+	}
+	return p.kind
+}
+
+// order sorts copies so the preferred keeper comes first, and drops copies
+// that a prefix or regex policy doesn't allow as keepers. The copies must
+// already be in path order.
+func (p KeepPolicy) order(copies []linkCandidate) []linkCandidate {
+	var allowed []linkCandidate
+	for _, c := range copies {
+		switch p.kind {
+		case "prefix":
+			if !isUnderRoot(p.prefix, c.path) {
+				continue
+			}
+		case "regex":
+			if !p.re.MatchString(c.path) {
+				continue
+			}
+		}
+		allowed = append(allowed, c)
+	}
+
+	switch p.kind {
+	case "", "shortest":
+		sort.SliceStable(allowed, func(i, j int) bool { return len(allowed[i].path) < len(allowed[j].path) })
+	case "oldest":
+		sort.SliceStable(allowed, func(i, j int) bool { return allowed[i].info.ModTime().Before(allowed[j].info.ModTime()) })
+	}
+	return allowed
+}
+
+// PruneOptions controls how redundant duplicates are removed.
+type PruneOptions struct {
+	// Keep picks the copy of each duplicate that stays in place.
+	Keep KeepPolicy
+
+	// Quarantine is a directory the redundant copies are moved into, keeping
+	// their absolute paths beneath it. If empty, Delete must be set.
+	Quarantine string
+
+	// Manifest is the JSON Lines file that records each quarantined file.
+	// It defaults to venn-manifest.jsonl in the quarantine directory.
+	Manifest string
+
+	// Delete removes the redundant copies instead of quarantining them.
+	Delete bool
+
+	// DryRun prints what would be removed without changing anything.
+	DryRun bool
+}
+
+// quarantineRecord is one line of a quarantine manifest. Original is the
+// absolute path the file was moved from, and IndexPath is the same path as the
+// index recorded it, which may be relative.
+type quarantineRecord struct {
+	Index       string    `json:"index"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Original    string    `json:"original"`
+	IndexPath   string    `json:"index_path"`
+	Quarantined string    `json:"quarantined"`
+	Keeper      string    `json:"keeper"`
+	Time        time.Time `json:"time"`
+}
+
+// pruneSummary counts the outcome of a prune run.
+type pruneSummary struct {
+	pruned    int
+	skipped   int
+	reclaimed int64
+}
+
+// Prune removes the redundant copies of every duplicated file in an index,
+// keeping one copy chosen by the keeper policy. Both the keeper and each
+// redundant copy are re-hashed before anything is touched, since the index may
+// be stale. Removed paths are dropped from the index.
+func Prune(logger hclog.Logger, dbPath, indexName string, opts PruneOptions) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if opts.Delete == (opts.Quarantine != "") {
+		return errors.New("exactly one of a quarantine directory or delete must be given")
+	}
+	if opts.Manifest == "" && opts.Quarantine != "" {
+		opts.Manifest = filepath.Join(opts.Quarantine, quarantineManifestName)
+	}
+
+	dupes, err := loadDuplicates(dbPath, indexName, DupesOptions{Sort: DupesSortHash})
+	if err != nil {
+		return err
+	}
+
+	var manifest *os.File
+	if opts.Quarantine != "" && !opts.DryRun {
+		if err := os.MkdirAll(opts.Quarantine, materializedDirMode); err != nil {
+			return fmt.Errorf("failed to create quarantine directory: %w", err)
+		}
+		manifest, err = os.OpenFile(opts.Manifest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, quarantineFileMode)
+		if err != nil {
+			return fmt.Errorf("failed to open manifest: %w", err)
+		}
+		defer manifest.Close()
+	}
+
+	var (
+		summary pruneSummary
+		removed = make(map[string][]byte) // path to hash
+	)
+	for _, d := range dupes {
+		victims := pruneCandidates(logger, d, opts.Keep, &summary)
+		for _, victim := range victims {
+			if err := pruneFile(logger, indexName, d, victim, opts, manifest); err != nil {
+				logger.Warn("failed to prune file", "path", victim.path, "error", err)
+				summary.skipped++
+				continue
+			}
+			if !opts.DryRun {
+				removed[victim.path] = d.hash
+			}
+			summary.pruned++
+			summary.reclaimed += victim.info.Size()
+		}
+	}
+
+	if len(removed) > 0 {
+		if err := removeIndexPaths(dbPath, indexName, removed); err != nil {
+			return fmt.Errorf("files were pruned but the index was not updated: %w", err)
+		}
+	}
+
+	verb := "pruned"
+	if opts.DryRun {
+		verb = "would be pruned"
+	}
+	fmt.Printf("%d files %s (%d bytes reclaimed), %d skipped\n",
+		summary.pruned, verb, summary.reclaimed, summary.skipped)
+	if manifest != nil {
+		fmt.Printf("Manifest written to %s\n", opts.Manifest)
+	}
+	return nil
+}
+
+// pruneCandidates picks a keeper for a duplicate and returns the verified
+// copies that should be removed in its favour. Copies that can't be read
+// or no longer match the index are skipped. If no keeper can be verified,
+// nothing is removed.
+func pruneCandidates(logger hclog.Logger, d duplicate, policy KeepPolicy, summary *pruneSummary) []*pruneVictim {
+	var copies []linkCandidate
+	for _, p := range sortedPaths(d.entry) {
+		info, err := os.Lstat(p)
+		if err != nil {
+			logger.Warn("skipping unreadable file", "path", p, "error", err)
+			summary.skipped++
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			logger.Debug("skipping file that is not a regular file", "path", p)
+			continue
+		}
+		copies = append(copies, linkCandidate{path: p, info: info})
+	}
+
+	verified := make(map[string]bool)
+	verify := func(c linkCandidate) bool {
+		ok, seen := verified[c.path]
+		if seen {
+			return ok
+		}
+		hash, err := hashFile(c.path)
+		switch {
+		case err != nil:
+			logger.Warn("skipping unreadable file", "path", c.path, "error", err)
+		case !bytes.Equal(hash, d.hash):
+			logger.Warn("skipping file that no longer matches the index", "path", c.path)
+		default:
+			ok = true
+		}
+		if !ok {
+			summary.skipped++
+		}
+		verified[c.path] = ok
+		return ok
+	}
+
+	var keeper *linkCandidate
+	for _, c := range policy.order(copies) {
+		if verify(c) {
+			keeper = &c
+			break
+		}
+	}
+	if keeper == nil {
+		logger.Warn("no copy can be kept, leaving all copies in place", "hash", hex.EncodeToString(d.hash))
+		return nil
+	}
+
+	var victims []*pruneVictim
+	for _, c := range copies {
+		if c.path == keeper.path {
+			continue
+		}
+		if os.SameFile(c.info, keeper.info) {
+			logger.Debug("skipping file that is a link to the keeper", "path", c.path, "keeper", keeper.path)
+			continue
+		}
+		if verify(c) {
+			victims = append(victims, &pruneVictim{linkCandidate: c, keeper: keeper.path})
+		}
+	}
+	return victims
+}
+
+// pruneVictim is a verified redundant copy and the copy kept in its place.
+type pruneVictim struct {
+	linkCandidate
+	keeper string
+}
+
+// pruneFile deletes or quarantines one redundant copy. A quarantined file is
+// recorded in the manifest before it is moved, so a crash can never leave a
+// moved file without a record.
+func pruneFile(logger hclog.Logger, indexName string, d duplicate, victim *pruneVictim, opts PruneOptions, manifest *os.File) error {
+	if opts.Delete {
+		if opts.DryRun {
+			fmt.Printf("delete %s (keeping %s)\n", victim.path, victim.keeper)
+			return nil
+		}
+		return os.Remove(victim.path)
+	}
+
+	original, err := filepath.Abs(victim.path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	dst := filepath.Join(opts.Quarantine, strings.TrimPrefix(original, filepath.VolumeName(original)))
+	if opts.DryRun {
+		fmt.Printf("quarantine %s -> %s (keeping %s)\n", victim.path, dst, victim.keeper)
+		return nil
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("quarantine path %q already exists", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), materializedDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	record := quarantineRecord{
+		Index:       indexName,
+		SHA256:      hex.EncodeToString(d.hash),
+		Size:        victim.info.Size(),
+		Original:    original,
+		Quarantined: dst,
+		IndexPath:   victim.path,
+		Keeper:      victim.keeper,
+		Time:        time.Now().UTC(),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest record: %w", err)
+	}
+	if _, err := manifest.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := manifest.Sync(); err != nil {
+		return fmt.Errorf("failed to sync manifest: %w", err)
+	}
+
+	logger.Debug("quarantining file", "path", victim.path, "quarantine", dst)
+	return moveFile(d.hash, victim.path, dst, victim.info.ModTime())
+}
+
+// moveFile renames src to dst, falling back to a copy and delete when they
+// are on different filesystems. The copy is verified against hash unless it
+// is nil.
+func moveFile(hash []byte, src, dst string, timestamp time.Time) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if hash == nil {
+		err = copyFileWithTime(src, dst, timestamp)
+	} else {
+		err = copyFileWithHash(hash, src, dst, timestamp)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// removeIndexPaths drops pruned paths from an index, deleting entries left
+// without any paths.
+func removeIndexPaths(dbPath, indexName string, removed map[string][]byte) error {
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+		if err != nil {
+			return err
+		}
+
+		for p, hash := range removed {
+			if err := removePath(bucket, hash, p); err != nil {
+				return err
+			}
+			if err := pathsBucket.Delete([]byte(p)); err != nil {
+				return fmt.Errorf("failed to delete path entry: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreQuarantine moves every file recorded in a quarantine manifest back
+// to its original path and adds the path back to its index entry. Files whose
+// original path is occupied again are left in quarantine.
+func RestoreQuarantine(logger hclog.Logger, dbPath, manifestPath string) error {
+	if manifestPath == "" {
+		return errors.New("manifest path cannot be empty")
+	}
+
+	records, err := readQuarantineManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	var restored []quarantineRecord
+	skipped := 0
+	for _, r := range records {
+		if _, err := os.Lstat(r.Original); err == nil {
+			logger.Warn("original path exists, leaving file in quarantine", "path", r.Original, "quarantine", r.Quarantined)
+			skipped++
+			continue
+		}
+		info, err := os.Stat(r.Quarantined)
+		if err != nil {
+			logger.Warn("quarantined file is missing", "path", r.Quarantined, "error", err)
+			skipped++
+			continue
+		}
+
+		hash, err := hex.DecodeString(r.SHA256)
+		if err != nil {
+			logger.Warn("invalid hash in manifest", "path", r.Quarantined, "error", err)
+			skipped++
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(r.Original), materializedDirMode); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := moveFile(hash, r.Quarantined, r.Original, info.ModTime()); err != nil {
+			logger.Warn("failed to restore file", "path", r.Original, "error", err)
+			skipped++
+			continue
+		}
+		restored = append(restored, r)
+	}
+
+	if len(restored) > 0 {
+		if err := restoreIndexPaths(logger, dbPath, restored); err != nil {
+			return fmt.Errorf("files were restored but the index was not updated: %w", err)
+		}
+	}
+
+	fmt.Printf("%d files restored, %d skipped\n", len(restored), skipped)
+	return nil
+}
+
+// readQuarantineManifest reads every record in a manifest.
+func readQuarantineManifest(path string) ([]quarantineRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var records []quarantineRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r quarantineRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid manifest record on line %d: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return records, nil
+}
+
+// restoreIndexPaths adds restored paths back to the entries they were pruned
+// from, as the index recorded them, along with their path state. Entries that
+// no longer exist, or whose index was deleted, are left alone.
+func restoreIndexPaths(logger hclog.Logger, dbPath string, restored []quarantineRecord) error {
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, r := range restored {
+			if !bucketExistsForIndex(tx, r.Index) {
+				logger.Warn("index no longer exists, not re-adding path", "index", r.Index, "path", r.Original)
+				continue
+			}
+
+			bucket, err := getBucketForIndex(tx, r.Index, hashesBucketKey)
+			if err != nil {
+				return err
+			}
+
+			hash, err := hex.DecodeString(r.SHA256)
+			if err != nil {
+				return fmt.Errorf("invalid hash in manifest: %w", err)
+			}
+			entry, err := getEntry(bucket, hash)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				logger.Warn("entry no longer exists, not re-adding path", "index", r.Index, "path", r.Original)
+				continue
+			}
+
+			entry.Paths[r.IndexPath] = struct{}{}
+			if err := putEntry(bucket, hash, entry); err != nil {
+				return err
+			}
+
+			// Record the restored file's state so a refresh can skip it
+			info, err := os.Stat(r.Original)
+			if err != nil {
+				logger.Warn("failed to stat restored file", "path", r.Original, "error", err)
+				continue
+			}
+			pathsBucket, err := getBucketForIndex(tx, r.Index, pathsBucketKey)
+			if err != nil {
+				return err
+			}
+			if err := putPathEntry(pathsBucket, r.IndexPath, newPathEntry(info, hash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
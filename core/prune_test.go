@@ -0,0 +1,297 @@
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexedPaths returns the paths stored for a hash in an index.
+func indexedPaths(t *testing.T, dbPath string, indexName string, hash []byte) map[string]struct{} {
+	t.Helper()
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var paths map[string]struct{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		entry, err := getEntry(bucket, hash)
+		if err != nil || entry == nil {
+			return err
+		}
+		paths = entry.Paths
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read entry: %v", err)
+	}
+	return paths
+}
+
+func TestParseKeepPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"shortest", "shortest", false},
+		{"oldest", "oldest", false},
+		{"prefix:/mnt/a/", "prefix:/mnt/a", false},
+		{"regex:^/keep/", "regex:^/keep/", false},
+		{"prefix:", "", true},
+		{"regex:(", "", true},
+		{"shortest:x", "", true},
+		{"newest", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseKeepPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeepPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseKeepPolicy() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepPolicy_Order(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	var copies []linkCandidate
+	for _, name := range []string{"a/long-name.txt", "b/x.txt", "keep/y.txt"} {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		if name == "keep/y.txt" {
+			if err := os.Chtimes(p, old, old); err != nil {
+				t.Fatalf("failed to set times: %v", err)
+			}
+		}
+		info, _ := os.Lstat(p)
+		copies = append(copies, linkCandidate{path: p, info: info})
+	}
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"shortest", "b/x.txt"},
+		{"oldest", "keep/y.txt"},
+		{"prefix:" + filepath.Join(tmpDir, "a"), "a/long-name.txt"},
+		{"regex:/keep/", "keep/y.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := ParseKeepPolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("ParseKeepPolicy() error = %v", err)
+			}
+			got := policy.order(copies)
+			if len(got) == 0 || got[0].path != filepath.Join(tmpDir, tt.want) {
+				t.Errorf("order() first = %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	policy, _ := ParseKeepPolicy("prefix:/nowhere")
+	if got := policy.order(copies); len(got) != 0 {
+		t.Errorf("order() = %v, want no allowed keepers", got)
+	}
+}
+
+func TestPrune_QuarantineAndRestore(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	tmpDir := writeDuplicates(t, dbPath, "test-index", "a.txt", "bb.txt", "ccc.txt")
+	quarantine := filepath.Join(t.TempDir(), "quarantine")
+
+	// Make one copy stale, so it must be skipped rather than pruned
+	stale := filepath.Join(tmpDir, "ccc.txt")
+	if err := os.WriteFile(stale, []byte("edited since indexing"), 0644); err != nil {
+		t.Fatalf("failed to edit test file: %v", err)
+	}
+
+	logger := hclog.NewNullLogger()
+	keep, _ := ParseKeepPolicy("shortest")
+	opts := PruneOptions{Keep: keep, Quarantine: quarantine}
+	if err := Prune(logger, dbPath, "test-index", opts); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "a.txt")); err != nil {
+		t.Errorf("keeper was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "bb.txt")); !os.IsNotExist(err) {
+		t.Errorf("bb.txt was not pruned: %v", err)
+	}
+	if got, _ := os.ReadFile(stale); string(got) != "edited since indexing" {
+		t.Errorf("stale file content = %q, want it untouched", got)
+	}
+
+	original, _ := filepath.Abs(filepath.Join(tmpDir, "bb.txt"))
+	if _, err := os.Stat(filepath.Join(quarantine, original)); err != nil {
+		t.Errorf("bb.txt is not in quarantine: %v", err)
+	}
+
+	hash := sha256.Sum256([]byte("duplicated content"))
+	paths := indexedPaths(t, dbPath, "test-index", hash[:])
+	if _, ok := paths[filepath.Join(tmpDir, "bb.txt")]; ok || len(paths) != 2 {
+		t.Errorf("paths after prune = %v, want bb.txt removed", paths)
+	}
+
+	manifest := filepath.Join(quarantine, quarantineManifestName)
+	if err := RestoreQuarantine(logger, dbPath, manifest); err != nil {
+		t.Fatalf("RestoreQuarantine() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "bb.txt")); string(got) != "duplicated content" {
+		t.Errorf("restored content = %q", got)
+	}
+
+	paths = indexedPaths(t, dbPath, "test-index", hash[:])
+	if _, ok := paths[original]; !ok {
+		t.Errorf("paths after restore = %v, want %s", paths, original)
+	}
+
+	// A second restore finds nothing left to move
+	if err := RestoreQuarantine(logger, dbPath, manifest); err != nil {
+		t.Fatalf("second RestoreQuarantine() error = %v", err)
+	}
+}
+
+func TestPrune_RestoreRelativePaths(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	// Index from a relative path, the way "venn index add-files" usually runs
+	if err := os.MkdirAll("tree", 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "bb.txt"} {
+		if err := os.WriteFile(filepath.Join("tree", name), []byte("duplicated content"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, "test-index", "tree", IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+	hash := sha256.Sum256([]byte("duplicated content"))
+	before := indexedPaths(t, dbPath, "test-index", hash[:])
+
+	quarantine := filepath.Join(t.TempDir(), "quarantine")
+	keep, _ := ParseKeepPolicy("shortest")
+	if err := Prune(logger, dbPath, "test-index", PruneOptions{Keep: keep, Quarantine: quarantine}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if err := RestoreQuarantine(logger, dbPath, filepath.Join(quarantine, quarantineManifestName)); err != nil {
+		t.Fatalf("RestoreQuarantine() error = %v", err)
+	}
+
+	after := indexedPaths(t, dbPath, "test-index", hash[:])
+	if len(after) != len(before) {
+		t.Errorf("paths after restore = %v, want %v", after, before)
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			t.Errorf("paths after restore = %v, missing %s", after, p)
+		}
+	}
+
+	restored := filepath.Join("tree", "bb.txt")
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		pathsBucket, err := getBucketForIndex(tx, "test-index", pathsBucketKey)
+		if err != nil {
+			return err
+		}
+		recorded, err := getPathEntry(pathsBucket, restored)
+		if err != nil {
+			return err
+		}
+		if recorded == nil {
+			t.Errorf("no path entry for restored %s", restored)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read path entry: %v", err)
+	}
+}
+
+func TestMoveFile_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Only a cross-device rename falls back to a copy; anything else is
+	// returned as it is
+	err := moveFile(nil, filepath.Join(tmpDir, "missing"), filepath.Join(tmpDir, "dst"), time.Time{})
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !os.IsNotExist(err) {
+		t.Errorf("moveFile() error = %v, want the rename's not-exist error", err)
+	}
+}
+
+func TestPrune_Delete(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	tmpDir := writeDuplicates(t, dbPath, "test-index", "a.txt", "b.txt", "c.txt")
+
+	logger := hclog.NewNullLogger()
+	keep, _ := ParseKeepPolicy("regex:c\\.txt$")
+
+	// A dry run leaves every file in place
+	if err := Prune(logger, dbPath, "test-index", PruneOptions{Keep: keep, Delete: true, DryRun: true}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("dry run removed %s: %v", name, err)
+		}
+	}
+
+	if err := Prune(logger, dbPath, "test-index", PruneOptions{Keep: keep, Delete: true}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	for name, want := range map[string]bool{"a.txt": false, "b.txt": false, "c.txt": true} {
+		_, err := os.Stat(filepath.Join(tmpDir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPrune_Validation(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	logger := hclog.NewNullLogger()
+
+	if err := Prune(logger, dbPath, "", PruneOptions{Delete: true}); err == nil {
+		t.Error("Prune() with empty index name should fail")
+	}
+	if err := Prune(logger, dbPath, "test-index", PruneOptions{}); err == nil {
+		t.Error("Prune() without quarantine or delete should fail")
+	}
+	if err := Prune(logger, dbPath, "test-index", PruneOptions{Delete: true, Quarantine: "q"}); err == nil {
+		t.Error("Prune() with both quarantine and delete should fail")
+	}
+}
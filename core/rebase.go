@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rebasePlan is the set of rewrites that moves an index's paths from one
+// prefix to another.
+type rebasePlan struct {
+	// entries are the rewritten entries, keyed by hash.
+	entries map[string]*indexEntry
+
+	// paths maps each rewritten path to its new path.
+	paths map[string]string
+
+	attachments int
+
+	// existing and missing count the rewritten paths and attachments that
+	// are and aren't found at their new location.
+	existing int
+	missing  []string
+}
+
+// IndexRebase rewrites the paths and attachments of an index that start with
+// oldPrefix to start with newPrefix instead, such as after a drive is mounted
+// somewhere else. Prefixes match whole path components and are compared as
+// the paths were recorded. All the rewrites happen in a single transaction,
+// and with dryRun the index is only read. Either way, the number of rewrites
+// and how many of the new paths exist are printed.
+func IndexRebase(logger hclog.Logger, dbPath, indexName, oldPrefix, newPrefix string, dryRun bool) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if oldPrefix == "" {
+		return errors.New("old prefix cannot be empty")
+	}
+	if newPrefix == "" {
+		return errors.New("new prefix cannot be empty")
+	}
+	oldPrefix, newPrefix = filepath.Clean(oldPrefix), filepath.Clean(newPrefix)
+	if oldPrefix == newPrefix {
+		return errors.New("old and new prefixes are the same")
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	run := db.Update
+	if dryRun {
+		run = db.View
+	}
+
+	var plan *rebasePlan
+	err = run(func(tx *bolt.Tx) error {
+		// A write transaction would quietly create a misspelled index
+		if !bucketExistsForIndex(tx, indexName) {
+			return fmt.Errorf("index %q does not exist", indexName)
+		}
+
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		// Indexes built by set operations or older versions have no path
+		// records, so there are none to move
+		pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+		if err != nil && !errors.Is(err, ErrIndexNotWellFormed) {
+			return err
+		}
+
+		if plan, err = planRebase(bucket, oldPrefix, newPrefix); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		return plan.apply(bucket, pathsBucket)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(plan.missing) > 0 {
+		logger.Warn("some rewritten paths do not exist", "missing", len(plan.missing), "example", plan.missing[0])
+	}
+
+	verb := "rewritten"
+	if dryRun {
+		verb = "would be rewritten"
+	}
+	fmt.Printf("%d paths and %d attachments %s: %d exist, %d missing\n",
+		len(plan.paths), plan.attachments, verb, plan.existing, len(plan.missing))
+	return nil
+}
+
+// planRebase works out the rewrites for every path and attachment in the
+// bucket under oldPrefix, checking whether each new path exists. It fails if
+// a new path is already listed in the index by a path that isn't rewritten.
+func planRebase(bucket *bolt.Bucket, oldPrefix, newPrefix string) (*rebasePlan, error) {
+	plan := &rebasePlan{
+		entries: make(map[string]*indexEntry),
+		paths:   make(map[string]string),
+	}
+	kept := make(map[string]bool)
+
+	check := func(p string) {
+		if _, err := os.Lstat(p); err == nil {
+			plan.existing++
+		} else {
+			plan.missing = append(plan.missing, p)
+		}
+	}
+
+	cursor := bucket.Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		entry, err := decodeEntry(entryData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		// Build new paths rather than editing them in place, since a new
+		// path can be another of the entry's old ones when the prefixes nest
+		modified := false
+		paths := make(map[string]struct{}, len(entry.Paths))
+		for p := range entry.Paths {
+			newPath, ok := rebasePath(oldPrefix, newPrefix, p)
+			if !ok {
+				kept[p] = true
+				paths[p] = struct{}{}
+				continue
+			}
+			paths[newPath] = struct{}{}
+			plan.paths[p] = newPath
+			check(newPath)
+			modified = true
+		}
+		entry.Paths = paths
+		for ext, p := range entry.Attachments {
+			if newPath, ok := rebasePath(oldPrefix, newPrefix, p); ok {
+				entry.Attachments[ext] = newPath
+				plan.attachments++
+				check(newPath)
+				modified = true
+			}
+		}
+
+		if modified {
+			plan.entries[string(hash)] = entry
+		}
+	}
+
+	for _, newPath := range plan.paths {
+		if kept[newPath] {
+			return nil, fmt.Errorf("path %q is already in the index", newPath)
+		}
+	}
+	return plan, nil
+}
+
+// apply writes the rewritten entries and moves the recorded state of each
+// rewritten path to its new path.
+func (plan *rebasePlan) apply(bucket, pathsBucket *bolt.Bucket) error {
+	for hash, entry := range plan.entries {
+		if err := putEntry(bucket, []byte(hash), entry); err != nil {
+			return err
+		}
+	}
+
+	// Read every record before writing any, since a new path can be another
+	// rewritten path's old one
+	records := make(map[string][]byte)
+	for oldPath := range plan.paths {
+		if v := pathsBucket.Get([]byte(oldPath)); v != nil {
+			records[oldPath] = bytes.Clone(v)
+		}
+		if err := pathsBucket.Delete([]byte(oldPath)); err != nil {
+			return fmt.Errorf("failed to delete path entry: %w", err)
+		}
+	}
+	for oldPath, v := range records {
+		if err := pathsBucket.Put([]byte(plan.paths[oldPath]), v); err != nil {
+			return fmt.Errorf("failed to put path entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebasePath returns p with oldPrefix replaced by newPrefix, and whether p is
+// oldPrefix or lies inside it.
+func rebasePath(oldPrefix, newPrefix, p string) (string, bool) {
+	if !isUnderRoot(oldPrefix, p) {
+		return "", false
+	}
+	rel, err := filepath.Rel(oldPrefix, p)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(newPrefix, rel), true
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRebasePath(t *testing.T) {
+	tests := []struct {
+		p    string
+		want string
+		ok   bool
+	}{
+		{"/media/old/a.jpg", "/mnt/backup/a.jpg", true},
+		{"/media/old/sub/b.jpg", "/mnt/backup/sub/b.jpg", true},
+		{"/media/old", "/mnt/backup", true},
+		{"/media/older/c.jpg", "", false},
+		{"/media/c.jpg", "", false},
+		{"media/old/d.jpg", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := rebasePath("/media/old", "/mnt/backup", tt.p)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("rebasePath(%q) = %q, %v, want %q, %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIndexRebase(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	oldRoot := filepath.Join(t.TempDir(), "old")
+	newRoot := filepath.Join(t.TempDir(), "new")
+	if err := os.MkdirAll(newRoot, 0755); err != nil {
+		t.Fatalf("failed to create new root: %v", err)
+	}
+	// Only one of the moved files made it to the new location
+	if err := os.WriteFile(filepath.Join(newRoot, "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	oldA := filepath.Join(oldRoot, "a.jpg")
+	oldB := filepath.Join(oldRoot, "sub", "b.jpg")
+	other := "/elsewhere/a.jpg"
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "idx", map[string]*indexEntry{
+			"a": {
+				Paths:       map[string]struct{}{oldA: {}, other: {}},
+				Attachments: map[string]string{".json": oldA + ".json"},
+				Size:        1,
+				Timestamp:   time.Now(),
+			},
+			"b": {
+				Paths:       map[string]struct{}{oldB: {}},
+				Attachments: map[string]string{},
+				Size:        1,
+				Timestamp:   time.Now(),
+			},
+		})
+		err = db.Update(func(tx *bolt.Tx) error {
+			pathsBucket, err := getBucketForIndex(tx, "idx", pathsBucketKey)
+			if err != nil {
+				return err
+			}
+			return putPathEntry(pathsBucket, oldA, &pathEntry{Size: 1, Hash: []byte("a")})
+		})
+		if err != nil {
+			t.Fatalf("failed to record path: %v", err)
+		}
+	}()
+
+	logger := hclog.NewNullLogger()
+	// readIndex returns the entries and which of the two locations of a.jpg
+	// have a recorded path state
+	readIndex := func() (map[string]*indexEntry, map[string]bool) {
+		t.Helper()
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		entries := make(map[string]*indexEntry)
+		recorded := make(map[string]bool)
+		err = db.View(func(tx *bolt.Tx) error {
+			bucket, err := getBucketForIndex(tx, "idx", hashesBucketKey)
+			if err != nil {
+				return err
+			}
+			for _, hash := range []string{"a", "b"} {
+				if entries[hash], err = getEntry(bucket, []byte(hash)); err != nil {
+					return err
+				}
+			}
+
+			pathsBucket, err := getBucketForIndex(tx, "idx", pathsBucketKey)
+			if err != nil {
+				return err
+			}
+			for _, p := range []string{oldA, filepath.Join(newRoot, "a.jpg")} {
+				e, err := getPathEntry(pathsBucket, p)
+				if err != nil {
+					return err
+				}
+				recorded[p] = e != nil
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to read index: %v", err)
+		}
+		return entries, recorded
+	}
+
+	// A dry run leaves everything in place
+	if err := IndexRebase(logger, dbPath, "idx", oldRoot, newRoot, true); err != nil {
+		t.Fatalf("IndexRebase dry run error = %v", err)
+	}
+	entries, recorded := readIndex()
+	if _, ok := entries["a"].Paths[oldA]; !ok || !recorded[oldA] {
+		t.Errorf("dry run rewrote %s: %v", oldA, entries["a"].Paths)
+	}
+
+	if err := IndexRebase(logger, dbPath, "idx", oldRoot+"/", newRoot, false); err != nil {
+		t.Fatalf("IndexRebase error = %v", err)
+	}
+	entries, recorded = readIndex()
+	wantA := map[string]struct{}{filepath.Join(newRoot, "a.jpg"): {}, other: {}}
+	if len(entries["a"].Paths) != len(wantA) {
+		t.Errorf("a paths = %v, want %v", entries["a"].Paths, wantA)
+	}
+	for p := range wantA {
+		if _, ok := entries["a"].Paths[p]; !ok {
+			t.Errorf("a paths = %v, missing %s", entries["a"].Paths, p)
+		}
+	}
+	if got := entries["a"].Attachments[".json"]; got != filepath.Join(newRoot, "a.jpg.json") {
+		t.Errorf("a attachment = %q", got)
+	}
+	if _, ok := entries["b"].Paths[filepath.Join(newRoot, "sub", "b.jpg")]; !ok || len(entries["b"].Paths) != 1 {
+		t.Errorf("b paths = %v", entries["b"].Paths)
+	}
+	if recorded[oldA] || !recorded[filepath.Join(newRoot, "a.jpg")] {
+		t.Errorf("path record was not moved: %v", recorded)
+	}
+
+	// Rebasing onto a path the index already lists would merge two files
+	if err := IndexRebase(logger, dbPath, "idx", newRoot, "/elsewhere", false); err == nil {
+		t.Error("IndexRebase onto a listed path should fail")
+	}
+	if err := IndexRebase(logger, dbPath, "idx", newRoot, newRoot+"/", false); err == nil {
+		t.Error("IndexRebase with the same prefixes should fail")
+	}
+	if err := IndexRebase(logger, dbPath, "missing", oldRoot, newRoot, false); err == nil {
+		t.Error("IndexRebase of a missing index should fail")
+	}
+}
+
+func TestIndexRebase_NestedPrefixes(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "idx", map[string]*indexEntry{
+			"h": {
+				Paths:       map[string]struct{}{"/a/a": {}, "/a/b/a": {}},
+				Attachments: map[string]string{},
+				Size:        1,
+				Timestamp:   time.Now(),
+			},
+		})
+		err = db.Update(func(tx *bolt.Tx) error {
+			pathsBucket, err := getBucketForIndex(tx, "idx", pathsBucketKey)
+			if err != nil {
+				return err
+			}
+			for _, p := range []string{"/a/a", "/a/b/a"} {
+				if err := putPathEntry(pathsBucket, p, &pathEntry{Size: 1, Hash: []byte("h")}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to record paths: %v", err)
+		}
+	}()
+
+	// The first path is rewritten to the second's old path
+	if err := IndexRebase(hclog.NewNullLogger(), dbPath, "idx", "/a", "/a/b", false); err != nil {
+		t.Fatalf("IndexRebase() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "idx", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		entry, err := getEntry(bucket, []byte("h"))
+		if err != nil {
+			return err
+		}
+		want := []string{"/a/b/a", "/a/b/b/a"}
+		if got := sortedPaths(entry); !slices.Equal(got, want) {
+			t.Errorf("paths = %v, want %v", got, want)
+		}
+
+		pathsBucket, err := getBucketForIndex(tx, "idx", pathsBucketKey)
+		if err != nil {
+			return err
+		}
+		var recorded []string
+		cursor := pathsBucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			recorded = append(recorded, string(k))
+		}
+		if !slices.Equal(recorded, want) {
+			t.Errorf("recorded paths = %v, want %v", recorded, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+}
+
+func TestIndexRebase_SetResult(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		for _, index := range []string{"i1", "i2"} {
+			createTestIndex(t, db, index, map[string]*indexEntry{
+				index: {
+					Paths:       map[string]struct{}{"/src/" + index + ".jpg": {}},
+					Attachments: map[string]string{},
+					Size:        1,
+					Timestamp:   time.Now(),
+				},
+			})
+		}
+	}()
+
+	// Set results have no path records, which a dry run only reads
+	logger := hclog.NewNullLogger()
+	if err := SetUnion(logger, dbPath, "u", "i1", "i2"); err != nil {
+		t.Fatalf("SetUnion() error = %v", err)
+	}
+	if err := IndexRebase(logger, dbPath, "u", "/src", "/mnt/src", true); err != nil {
+		t.Fatalf("IndexRebase dry run error = %v", err)
+	}
+	if err := IndexRebase(logger, dbPath, "u", "/src", "/mnt/src", false); err != nil {
+		t.Fatalf("IndexRebase error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "u", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		for _, index := range []string{"i1", "i2"} {
+			entry, err := getEntry(bucket, []byte(index))
+			if err != nil {
+				return err
+			}
+			want := []string{"/mnt/src/" + index + ".jpg"}
+			if got := sortedPaths(entry); !slices.Equal(got, want) {
+				t.Errorf("%s paths = %v, want %v", index, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build linux
+
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile makes dst share the data blocks of src using the FICLONE ioctl.
+// Both files must be on the same filesystem and it must support reflinks,
+// such as Btrfs or XFS.
+func reflinkFile(src, dst *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
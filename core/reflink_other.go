@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// reflinkFile reports that reflinks are not supported on this platform.
+func reflinkFile(src, dst *os.File) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// IndexRefresh re-scans a root path that was previously added to an index. New
+// files are added, changed files are moved to their new hash, and paths under
+// the root that no longer exist are removed. Entries left without any paths
+// are deleted. Roots that were added from a Google Photos takeout are
+// re-scanned as a takeout, so their metadata files stay attachments.
+func IndexRefresh(logger hclog.Logger, dbPath, indexName, rootPath string, opts IndexAddOptions) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if rootPath == "" {
+		return errors.New("root path cannot be empty")
+	}
+
+	// Check the index exists first, since adding files would create it
+	fn := indexFile
+	err := func() error {
+		db, err := getDB(dbPath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		return db.View(func(tx *bolt.Tx) error {
+			if !bucketExistsForIndex(tx, indexName) {
+				return fmt.Errorf("index %q does not exist", indexName)
+			}
+
+			takeout, err := hasTakeoutMetadata(tx, indexName, rootPath)
+			if takeout {
+				fn = indexGooglePhotosTakeout
+			}
+			return err
+		})
+	}()
+	if err != nil {
+		return err
+	}
+
+	changes, err := indexAdd(logger, dbPath, fn, indexName, rootPath, opts)
+	if err != nil {
+		return err
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return pruneMissing(logger, tx, indexName, rootPath, changes)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d paths added, %d paths changed, %d paths removed\n",
+		changes.added, changes.changed, changes.removed)
+	return nil
+}
+
+// hasTakeoutMetadata reports whether any file under rootPath has a takeout
+// metadata file attached, which only indexing the root as a Google Photos
+// takeout does.
+func hasTakeoutMetadata(tx *bolt.Tx, indexName, rootPath string) (bool, error) {
+	bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+	if err != nil {
+		return false, err
+	}
+
+	root := filepath.Clean(rootPath)
+	cursor := bucket.Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		entry, err := decodeEntry(entryData)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode entry: %w", err)
+		}
+		for p := range entry.Paths {
+			if isUnderRoot(root, p) && entry.Attachments[takeoutMetadataExt] == p+takeoutMetadataExt {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// pruneMissing removes paths under rootPath that no longer exist on disk, as
+// well as paths whose recorded hash no longer matches the entry that lists
+// them. Entries left without any paths are deleted.
+func pruneMissing(logger hclog.Logger, tx *bolt.Tx, indexName, rootPath string, changes *pathChanges) error {
+	bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+	if err != nil {
+		return err
+	}
+
+	pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+	if err != nil {
+		return err
+	}
+
+	// Collect the updates first, since the bucket can't be modified while
+	// its cursor is in use
+	type update struct {
+		hash  []byte
+		entry *indexEntry
+	}
+	var updates []update
+
+	root := filepath.Clean(rootPath)
+	cursor := bucket.Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		entry, err := decodeEntry(entryData)
+		if err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		modified := false
+		for p := range entry.Paths {
+			if !isUnderRoot(root, p) {
+				continue
+			}
+
+			if _, err := os.Lstat(p); os.IsNotExist(err) {
+				logger.Debug("removing missing path", "path", p)
+				delete(entry.Paths, p)
+				if err := pathsBucket.Delete([]byte(p)); err != nil {
+					return fmt.Errorf("failed to delete path entry: %w", err)
+				}
+				changes.removed++
+				modified = true
+				continue
+			} else if err != nil {
+				logger.Warn("failed to stat path, keeping it", "path", p, "error", err)
+				continue
+			}
+
+			// The scan recorded this path under a different hash, which
+			// happens for indexes built before paths were tracked
+			recorded, err := getPathEntry(pathsBucket, p)
+			if err != nil {
+				return err
+			}
+			if recorded != nil && !bytes.Equal(recorded.Hash, hash) {
+				logger.Debug("removing stale path", "path", p)
+				delete(entry.Paths, p)
+				modified = true
+			}
+		}
+
+		if modified {
+			updates = append(updates, update{hash: bytes.Clone(hash), entry: entry})
+		}
+	}
+
+	for _, u := range updates {
+		if len(u.entry.Paths) == 0 {
+			if err := bucket.Delete(u.hash); err != nil {
+				return fmt.Errorf("failed to delete entry: %w", err)
+			}
+			continue
+		}
+		if err := putEntry(bucket, u.hash, u.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isUnderRoot reports whether path is root or lies inside it. Both are
+// compared as written, so they must be relative to the same directory.
+func isUnderRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIndexRefresh(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+	write("keep.txt", "keep")
+	write("delete.txt", "delete")
+	write("change.txt", "before")
+	write("dup1.txt", "dup")
+	write("dup2.txt", "dup")
+
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(tmpDir, "delete.txt")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tmpDir, "dup2.txt")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	write("change.txt", "after, and longer")
+	write("new.txt", "new")
+
+	if err := IndexRefresh(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexRefresh() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		wantPaths := map[string][]string{
+			"keep":              {"keep.txt"},
+			"after, and longer": {"change.txt"},
+			"dup":               {"dup1.txt"},
+			"new":               {"new.txt"},
+		}
+		count := 0
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			count++
+		}
+		if count != len(wantPaths) {
+			t.Errorf("index has %d entries, want %d", count, len(wantPaths))
+		}
+
+		for content, names := range wantPaths {
+			hash := sha256.Sum256([]byte(content))
+			entry, err := getEntry(bucket, hash[:])
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				t.Errorf("missing entry for %q", content)
+				continue
+			}
+			if len(entry.Paths) != len(names) {
+				t.Errorf("entry for %q has paths %v, want %v", content, entry.Paths, names)
+			}
+			for _, name := range names {
+				if _, ok := entry.Paths[filepath.Join(tmpDir, name)]; !ok {
+					t.Errorf("entry for %q is missing path %q", content, name)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
+
+func TestIndexRefresh_Errors(t *testing.T) {
+	dbPath := initTestDatabase(t)
+	logger := hclog.NewNullLogger()
+
+	tests := []struct {
+		name      string
+		indexName string
+		rootPath  string
+	}{
+		{"empty index name", "", "/tmp"},
+		{"empty root path", "test", ""},
+		{"missing index", "missing", t.TempDir()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := IndexRefresh(logger, dbPath, tt.indexName, tt.rootPath, IndexAddOptions{}); err == nil {
+				t.Error("IndexRefresh() expected error")
+			}
+		})
+	}
+}
+
+func TestIsUnderRoot(t *testing.T) {
+	tests := []struct {
+		root string
+		path string
+		want bool
+	}{
+		{"photos", "photos/a.jpg", true},
+		{"photos", "photos", true},
+		{"photos", "photos2/a.jpg", false},
+		{".", "a.jpg", true},
+		{".", "../a.jpg", false},
+		{"/mnt/photos", "/mnt/photos/x/a.jpg", true},
+		{"/mnt/photos", "/mnt/other/a.jpg", false},
+		{"/mnt/photos", "photos/a.jpg", false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnderRoot(tt.root, tt.path); got != tt.want {
+			t.Errorf("isUnderRoot(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIndexRefresh_Takeout(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	logger := hclog.NewNullLogger()
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+	metadata := `{"photoTakenTime": {"timestamp": "1609459200"}}`
+	write("a.jpg", "photo a")
+	write("a.jpg.json", metadata)
+
+	if err := IndexAddGooglePhotosTakeout(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddGooglePhotosTakeout() error = %v", err)
+	}
+
+	write("b.jpg", "photo b")
+	write("b.jpg.json", metadata)
+	if err := IndexRefresh(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexRefresh() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "test-index", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		// Metadata files stay attachments rather than becoming entries
+		count := 0
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			count++
+		}
+		if count != 2 {
+			t.Errorf("index has %d entries, want 2", count)
+		}
+
+		for _, name := range []string{"a.jpg", "b.jpg"} {
+			hash := sha256.Sum256([]byte("photo " + name[:1]))
+			entry, err := getEntry(bucket, hash[:])
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				t.Errorf("missing entry for %s", name)
+				continue
+			}
+			want := filepath.Join(tmpDir, name+".json")
+			if got := entry.Attachments[".json"]; got != want {
+				t.Errorf("%s attachment = %q, want %q", name, got, want)
+			}
+			if entry.Timestamp.Unix() != 1609459200 {
+				t.Errorf("%s timestamp = %v, want the metadata's", name, entry.Timestamp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
@@ -8,19 +8,58 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
-// SetDifference creates a new index containing entries in A but not in B (A - B).
-func SetDifference(logger hclog.Logger, targetIndex, indexA, indexB string) error {
+// setFn computes a set operation over the hashes buckets of its inputs,
+// writing the result to target and returning the number of entries written.
+type setFn func(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error)
+
+// SetDifference creates a new index containing entries in the first index but
+// in none of the others (A - B - C ...).
+func SetDifference(logger hclog.Logger, dbPath, targetIndex string, indexNames ...string) error {
+	return setOperation(logger, dbPath, "difference", subtract, targetIndex, indexNames)
+}
+
+// SetDifferenceByPath creates a new index from the first index with the paths
+// of the others removed from its entries, dropping an entry only once it has
+// no paths left. A path is only removed if another index has it with the same
+// hash, so other copies of the same content are kept.
+func SetDifferenceByPath(logger hclog.Logger, dbPath, targetIndex string, indexNames ...string) error {
+	return setOperation(logger, dbPath, "difference by path", subtractPaths, targetIndex, indexNames)
+}
+
+// SetIntersection creates a new index containing entries in every index
+// (A ∩ B ∩ C ...).
+func SetIntersection(logger hclog.Logger, dbPath, targetIndex string, indexNames ...string) error {
+	return setOperation(logger, dbPath, "intersection", intersect, targetIndex, indexNames)
+}
+
+// SetUnion creates a new index containing all entries from every index
+// (A ∪ B ∪ C ...).
+func SetUnion(logger hclog.Logger, dbPath, targetIndex string, indexNames ...string) error {
+	return setOperation(logger, dbPath, "union", merge, targetIndex, indexNames)
+}
+
+// SetSymmetricDifference creates a new index containing entries that are in
+// exactly one of the indexes, which for two indexes is (A - B) ∪ (B - A).
+func SetSymmetricDifference(logger hclog.Logger, dbPath, targetIndex string, indexNames ...string) error {
+	return setOperation(logger, dbPath, "symmetric difference", symmetricDifference, targetIndex, indexNames)
+}
+
+// setOperation runs a set operation over two or more input indexes, creating
+// the target index with the result in a single transaction.
+func setOperation(logger hclog.Logger, dbPath, op string, fn setFn, targetIndex string, indexNames []string) error {
 	if targetIndex == "" {
 		return errors.New("target index name cannot be empty")
 	}
-	if indexA == "" {
-		return errors.New("index A name cannot be empty")
+	if len(indexNames) < 2 {
+		return fmt.Errorf("set %s needs at least two input indexes", op)
 	}
-	if indexB == "" {
-		return errors.New("index B name cannot be empty")
+	for _, name := range indexNames {
+		if name == "" {
+			return errors.New("input index name cannot be empty")
+		}
 	}
 
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		return err
 	}
@@ -36,205 +75,240 @@ func SetDifference(logger hclog.Logger, targetIndex, indexA, indexB string) erro
 			return err
 		}
 
-		bucketA, err := getBucketForIndex(tx, indexA, hashesBucketKey)
-		if err != nil {
-			return err
+		sources := make([]*bolt.Bucket, 0, len(indexNames))
+		for _, name := range indexNames {
+			bucket, err := getBucketForIndex(tx, name, hashesBucketKey)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, bucket)
 		}
 
-		bucketB, err := getBucketForIndex(tx, indexB, hashesBucketKey)
+		count, err := fn(targetBucket, sources...)
 		if err != nil {
 			return err
 		}
 
-		// Add entries from A that are not in B
-		count := 0
-		cursor := bucketA.Cursor()
-		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
-			if bucketB.Get(hash) == nil {
-				if err := targetBucket.Put(hash, entryData); err != nil {
-					return fmt.Errorf("failed to put entry: %w", err)
-				}
-				count++
-			}
-		}
-
-		logger.Info("set difference completed", "target", targetIndex, "A", indexA, "B", indexB, "entries", count)
+		logger.Info("set "+op+" completed", "target", targetIndex, "indexes", indexNames, "entries", count)
 		return nil
 	})
 }
 
-// SetIntersection creates a new index containing entries in both A and B (A ∩ B).
-func SetIntersection(logger hclog.Logger, targetIndex, indexA, indexB string) error {
-	if targetIndex == "" {
-		return errors.New("target index name cannot be empty")
-	}
-	if indexA == "" {
-		return errors.New("index A name cannot be empty")
-	}
-	if indexB == "" {
-		return errors.New("index B name cannot be empty")
-	}
+// subtract copies entries from the first source that aren't in any of the
+// others into the target bucket.
+// Returns the number of entries added to the target.
+func subtract(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error) {
+	count := 0
+	err := walkByMembership(sources[0], sources[1:], false, func(hash, entryData []byte) error {
+		if err := target.Put(hash, entryData); err != nil {
+			return fmt.Errorf("failed to put entry: %w", err)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
 
-	db, err := getDB()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+// subtractPaths copies entries from the first source into the target bucket
+// without the paths and attachments the other sources have for the same hash.
+// Entries left without any paths are dropped.
+// Returns the number of entries added to the target.
+func subtractPaths(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error) {
+	count := 0
 
-	return db.Update(func(tx *bolt.Tx) error {
-		if bucketExistsForIndex(tx, targetIndex) {
-			return fmt.Errorf("target index %q already exists", targetIndex)
+	cursor := sources[0].Cursor()
+	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+		// Entries no other source has are copied as they are
+		if !inAny(hash, sources[1:]) {
+			if err := target.Put(hash, entryData); err != nil {
+				return count, fmt.Errorf("failed to put entry: %w", err)
+			}
+			count++
+			continue
 		}
 
-		targetBucket, err := getBucketForIndex(tx, targetIndex, hashesBucketKey)
+		entry, err := decodeEntry(entryData)
 		if err != nil {
-			return err
+			return count, fmt.Errorf("failed to decode entry: %w", err)
 		}
-
-		bucketA, err := getBucketForIndex(tx, indexA, hashesBucketKey)
-		if err != nil {
-			return err
+		for _, other := range sources[1:] {
+			otherEntry, err := getEntry(other, hash)
+			if err != nil {
+				return count, fmt.Errorf("failed to get entry: %w", err)
+			}
+			if otherEntry == nil {
+				continue
+			}
+			for p := range otherEntry.Paths {
+				delete(entry.Paths, p)
+			}
+			for ext, p := range otherEntry.Attachments {
+				if entry.Attachments[ext] == p {
+					delete(entry.Attachments, ext)
+				}
+			}
+		}
+		if len(entry.Paths) == 0 {
+			continue
 		}
 
-		bucketB, err := getBucketForIndex(tx, indexB, hashesBucketKey)
-		if err != nil {
-			return err
+		if err := putEntry(target, hash, entry); err != nil {
+			return count, fmt.Errorf("failed to put entry: %w", err)
 		}
+		count++
+	}
+
+	return count, nil
+}
+
+// symmetricDifference copies entries that are in exactly one source into the
+// target bucket.
+// Returns the number of entries added to the target.
+func symmetricDifference(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error) {
+	count := 0
+
+	for i, source := range sources {
+		others := make([]*bolt.Bucket, 0, len(sources)-1)
+		others = append(append(others, sources[:i]...), sources[i+1:]...)
 
-		count, err := intersect(bucketA, bucketB, targetBucket)
+		err := walkByMembership(source, others, false, func(hash, entryData []byte) error {
+			if err := target.Put(hash, entryData); err != nil {
+				return fmt.Errorf("failed to put entry: %w", err)
+			}
+			count++
+			return nil
+		})
 		if err != nil {
-			return err
+			return count, err
 		}
+	}
 
-		logger.Info("set intersection completed", "target", targetIndex, "A", indexA, "B", indexB, "entries", count)
-		return nil
-	})
+	return count, nil
 }
 
-// SetUnion creates a new index containing all entries from A and B (A ∪ B).
-func SetUnion(logger hclog.Logger, targetIndex, indexA, indexB string) error {
-	if targetIndex == "" {
-		return errors.New("target index name cannot be empty")
-	}
-	if indexA == "" {
-		return errors.New("index A name cannot be empty")
-	}
-	if indexB == "" {
-		return errors.New("index B name cannot be empty")
-	}
+// merge combines entries from every source bucket into the target bucket.
+// When a hash exists in more than one source, the entries are merged, keeping
+// the size and timestamp from the first source that has it.
+// Returns the number of entries added to the target.
+func merge(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error) {
+	count := 0
 
-	db, err := getDB()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+	for i, source := range sources {
+		cursor := source.Cursor()
+		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+			// Skip if already merged from an earlier source
+			if target.Get(hash) != nil {
+				continue
+			}
 
-	return db.Update(func(tx *bolt.Tx) error {
-		if bucketExistsForIndex(tx, targetIndex) {
-			return fmt.Errorf("target index %q already exists", targetIndex)
-		}
+			entry, err := mergeLater(hash, entryData, sources[i+1:])
+			if err != nil {
+				return count, err
+			}
 
-		targetBucket, err := getBucketForIndex(tx, targetIndex, hashesBucketKey)
-		if err != nil {
-			return err
+			// Entries only found here are copied as they are
+			if entry == nil {
+				if err := target.Put(hash, entryData); err != nil {
+					return count, fmt.Errorf("failed to put entry: %w", err)
+				}
+			} else if err := putEntry(target, hash, entry); err != nil {
+				return count, fmt.Errorf("failed to put merged entry: %w", err)
+			}
+			count++
 		}
+	}
 
-		bucketA, err := getBucketForIndex(tx, indexA, hashesBucketKey)
-		if err != nil {
-			return err
-		}
+	return count, nil
+}
 
-		bucketB, err := getBucketForIndex(tx, indexB, hashesBucketKey)
+// mergeLater decodes an entry and merges in the entries for the same hash
+// from the later sources. It returns nil if none of them have the hash.
+func mergeLater(hash, entryData []byte, later []*bolt.Bucket) (*indexEntry, error) {
+	var entry *indexEntry
+	for _, other := range later {
+		otherEntry, err := getEntry(other, hash)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to get entry: %w", err)
 		}
-
-		count, err := merge(bucketA, bucketB, targetBucket)
-		if err != nil {
-			return err
+		if otherEntry == nil {
+			continue
 		}
 
-		logger.Info("set union completed", "target", targetIndex, "A", indexA, "B", indexB, "entries", count)
-		return nil
-	})
+		if entry == nil {
+			if entry, err = decodeEntry(entryData); err != nil {
+				return nil, fmt.Errorf("failed to decode entry: %w", err)
+			}
+		}
+		entry.merge(otherEntry)
+	}
+	return entry, nil
 }
 
-// merge combines entries from first and second buckets into the target bucket.
-// When a hash exists in both buckets, the entries are merged.
+// intersect creates entries in the target bucket for hashes that exist in
+// every source. Entries from all sources are merged.
 // Returns the number of entries added to the target.
-func merge(first, second, target *bolt.Bucket) (int, error) {
+func intersect(target *bolt.Bucket, sources ...*bolt.Bucket) (int, error) {
 	count := 0
 
-	// Process all entries from first bucket
-	cursor := first.Cursor()
+	cursor := sources[0].Cursor()
 	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
-		entry, err := decodeEntry(entryData)
-		if err != nil {
-			return count, fmt.Errorf("failed to decode entry from first bucket: %w", err)
+		// Only include if found in every bucket
+		if !inAll(hash, sources[1:]) {
+			continue
 		}
 
-		// Check if this hash exists in second bucket
-		otherEntry, err := getEntry(second, hash)
+		entry, err := decodeEntry(entryData)
 		if err != nil {
-			return count, fmt.Errorf("failed to get entry from second bucket: %w", err)
+			return count, fmt.Errorf("failed to decode entry: %w", err)
 		}
-
-		// Merge if found in both
-		if otherEntry != nil {
+		for _, other := range sources[1:] {
+			otherEntry, err := getEntry(other, hash)
+			if err != nil {
+				return count, fmt.Errorf("failed to get entry: %w", err)
+			}
 			entry.merge(otherEntry)
 		}
 
 		if err := putEntry(target, hash, entry); err != nil {
-			return count, fmt.Errorf("failed to put merged entry: %w", err)
+			return count, fmt.Errorf("failed to put intersected entry: %w", err)
 		}
 		count++
 	}
 
-	// Process entries from second bucket that weren't in first
-	cursor = second.Cursor()
+	return count, nil
+}
+
+// walkByMembership calls fn for each entry in source whose hash is in any of
+// the others if in is true, or in none of them if in is false.
+func walkByMembership(source *bolt.Bucket, others []*bolt.Bucket, in bool, fn func(hash, entryData []byte) error) error {
+	cursor := source.Cursor()
 	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
-		// Skip if already processed (exists in first)
-		if first.Get(hash) != nil {
+		if inAny(hash, others) != in {
 			continue
 		}
-
-		if err := target.Put(hash, entryData); err != nil {
-			return count, fmt.Errorf("failed to put entry from second bucket: %w", err)
+		if err := fn(hash, entryData); err != nil {
+			return err
 		}
-		count++
 	}
-
-	return count, nil
+	return nil
 }
 
-// intersect creates entries in the target bucket for hashes that exist in both first and second.
-// Entries from both buckets are merged.
-// Returns the number of entries added to the target.
-func intersect(first, second, target *bolt.Bucket) (int, error) {
-	count := 0
-
-	cursor := first.Cursor()
-	for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
-		entry, err := decodeEntry(entryData)
-		if err != nil {
-			return count, fmt.Errorf("failed to decode entry from first bucket: %w", err)
-		}
-
-		// Check if this hash exists in second bucket
-		otherEntry, err := getEntry(second, hash)
-		if err != nil {
-			return count, fmt.Errorf("failed to get entry from second bucket: %w", err)
+// inAny reports whether any of the buckets has the hash.
+func inAny(hash []byte, buckets []*bolt.Bucket) bool {
+	for _, b := range buckets {
+		if b.Get(hash) != nil {
+			return true
 		}
+	}
+	return false
+}
 
-		// Only include if found in both buckets
-		if otherEntry != nil {
-			entry.merge(otherEntry)
-			if err := putEntry(target, hash, entry); err != nil {
-				return count, fmt.Errorf("failed to put intersected entry: %w", err)
-			}
-			count++
+// inAll reports whether every bucket has the hash.
+func inAll(hash []byte, buckets []*bolt.Bucket) bool {
+	for _, b := range buckets {
+		if b.Get(hash) == nil {
+			return false
 		}
 	}
-
-	return count, nil
+	return true
 }
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,14 +15,9 @@ import (
 // removed automatically when the test finishes.
 func setupTestDatabase(t *testing.T) *bolt.DB {
 	t.Helper()
-	t.Chdir(t.TempDir())
+	dbPath := initTestDatabase(t)
 
-	logger := hclog.NewNullLogger()
-	if err := CreateDB(logger); err != nil {
-		t.Fatalf("failed to create test database: %v", err)
-	}
-
-	db, err := getDB()
+	db, err := getDB(dbPath)
 	if err != nil {
 		t.Fatalf("failed to open test database: %v", err)
 	}
@@ -31,17 +27,20 @@ func setupTestDatabase(t *testing.T) *bolt.DB {
 }
 
 // initTestDatabase creates a test database in a temporary working directory for
-// tests that call core functions. The database is created but not kept open,
-// allowing core functions to open it themselves; the working directory is
-// removed automatically when the test finishes.
-func initTestDatabase(t *testing.T) {
+// tests that call core functions and returns its path. The database is created
+// but not kept open, allowing core functions to open it themselves; the
+// working directory is removed automatically when the test finishes.
+func initTestDatabase(t *testing.T) string {
 	t.Helper()
-	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	t.Chdir(dir)
 
+	dbPath := filepath.Join(dir, DefaultDBPath)
 	logger := hclog.NewNullLogger()
-	if err := CreateDB(logger); err != nil {
+	if err := CreateDB(logger, dbPath); err != nil {
 		t.Fatalf("failed to create test database: %v", err)
 	}
+	return dbPath
 }
 
 func createTestIndex(t *testing.T, db *bolt.DB, indexName string, hashes map[string]*indexEntry) {
@@ -68,8 +67,27 @@ func createTestIndex(t *testing.T, db *bolt.DB, indexName string, hashes map[str
 	}
 }
 
+// entryCount returns the number of entries in an index.
+func entryCount(t *testing.T, db *bolt.DB, indexName string) int {
+	t.Helper()
+
+	count := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+		count = bucket.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to count entries: %v", err)
+	}
+	return count
+}
+
 func TestSetDifference(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test data
 	indexAData := map[string]*indexEntry{
@@ -108,7 +126,7 @@ func TestSetDifference(t *testing.T) {
 
 	// Populate test data
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -119,14 +137,14 @@ func TestSetDifference(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := SetDifference(logger, "result", "indexA", "indexB")
+	err := SetDifference(logger, dbPath, "result", "indexA", "indexB")
 	if err != nil {
 		t.Fatalf("SetDifference() error = %v", err)
 	}
 
 	// Verify result contains hash1 and hash3, but not hash2
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database for verification: %v", err)
 		}
@@ -163,7 +181,7 @@ func TestSetDifference(t *testing.T) {
 }
 
 func TestSetIntersection(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create test data with overlapping entries
 	indexAData := map[string]*indexEntry{
@@ -201,7 +219,7 @@ func TestSetIntersection(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -211,14 +229,14 @@ func TestSetIntersection(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := SetIntersection(logger, "result", "indexA", "indexB")
+	err := SetIntersection(logger, dbPath, "result", "indexA", "indexB")
 	if err != nil {
 		t.Fatalf("SetIntersection() error = %v", err)
 	}
 
 	// Verify result contains only hash2
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database for verification: %v", err)
 		}
@@ -263,7 +281,7 @@ func TestSetIntersection(t *testing.T) {
 }
 
 func TestSetUnion(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	indexAData := map[string]*indexEntry{
 		"hash1": {
@@ -300,7 +318,7 @@ func TestSetUnion(t *testing.T) {
 	}
 
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -310,14 +328,14 @@ func TestSetUnion(t *testing.T) {
 	}()
 
 	logger := hclog.NewNullLogger()
-	err := SetUnion(logger, "result", "indexA", "indexB")
+	err := SetUnion(logger, dbPath, "result", "indexA", "indexB")
 	if err != nil {
 		t.Fatalf("SetUnion() error = %v", err)
 	}
 
 	// Verify result contains all hashes
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database for verification: %v", err)
 		}
@@ -364,7 +382,185 @@ func TestSetUnion(t *testing.T) {
 	}()
 }
 
+func TestSetOperations_NAry(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	entry := func(path string) *indexEntry {
+		return &indexEntry{
+			Paths:       map[string]struct{}{path: {}},
+			Attachments: map[string]string{},
+			Size:        100,
+			Timestamp:   time.Now(),
+		}
+	}
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "a", map[string]*indexEntry{
+			"all":   entry("a/all"),
+			"ab":    entry("a/ab"),
+			"aOnly": entry("a/only"),
+		})
+		createTestIndex(t, db, "b", map[string]*indexEntry{
+			"all": entry("b/all"),
+			"ab":  entry("b/ab"),
+		})
+		createTestIndex(t, db, "c", map[string]*indexEntry{
+			"all":   entry("c/all"),
+			"cOnly": entry("c/only"),
+		})
+	}()
+
+	logger := hclog.NewNullLogger()
+	if err := SetUnion(logger, dbPath, "union", "a", "b", "c"); err != nil {
+		t.Fatalf("SetUnion() error = %v", err)
+	}
+	if err := SetIntersection(logger, dbPath, "intersection", "a", "b", "c"); err != nil {
+		t.Fatalf("SetIntersection() error = %v", err)
+	}
+	if err := SetDifference(logger, dbPath, "difference", "a", "b", "c"); err != nil {
+		t.Fatalf("SetDifference() error = %v", err)
+	}
+	if err := SetSymmetricDifference(logger, dbPath, "symmetric", "a", "b", "c"); err != nil {
+		t.Fatalf("SetSymmetricDifference() error = %v", err)
+	}
+	if err := SetSymmetricDifference(logger, dbPath, "symmetric2", "a", "c"); err != nil {
+		t.Fatalf("SetSymmetricDifference() error = %v", err)
+	}
+
+	tests := []struct {
+		index string
+		want  map[string]int
+	}{
+		{"union", map[string]int{"all": 3, "ab": 2, "aOnly": 1, "cOnly": 1}},
+		{"intersection", map[string]int{"all": 3}},
+		{"difference", map[string]int{"aOnly": 1}},
+		{"symmetric", map[string]int{"aOnly": 1, "cOnly": 1}},
+		{"symmetric2", map[string]int{"ab": 1, "aOnly": 1, "cOnly": 1}},
+	}
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	for _, tt := range tests {
+		if n := entryCount(t, db, tt.index); n != len(tt.want) {
+			t.Errorf("%s has %d entries, want %d", tt.index, n, len(tt.want))
+		}
+		err := db.View(func(tx *bolt.Tx) error {
+			bucket, err := getBucketForIndex(tx, tt.index, hashesBucketKey)
+			if err != nil {
+				return err
+			}
+			for hash, paths := range tt.want {
+				e, err := getEntry(bucket, []byte(hash))
+				if err != nil {
+					return err
+				}
+				if e == nil {
+					t.Errorf("%s missing %s", tt.index, hash)
+				} else if len(e.Paths) != paths {
+					t.Errorf("%s %s has %d paths, want %d", tt.index, hash, len(e.Paths), paths)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("verification error = %v", err)
+		}
+	}
+}
+
+func TestSetDifferenceByPath(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	entry := func(attachments map[string]string, paths ...string) *indexEntry {
+		e := &indexEntry{
+			Paths:       map[string]struct{}{},
+			Attachments: attachments,
+			Size:        100,
+			Timestamp:   time.Now(),
+		}
+		for _, p := range paths {
+			e.Paths[p] = struct{}{}
+		}
+		return e
+	}
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "photos", map[string]*indexEntry{
+			"copied":  entry(map[string]string{".json": "bad/copied.json"}, "good/copied", "bad/copied"),
+			"badOnly": entry(map[string]string{}, "bad/only"),
+			"good":    entry(map[string]string{}, "good/only"),
+			"changed": entry(map[string]string{}, "bad/changed"),
+		})
+		createTestIndex(t, db, "bad_import", map[string]*indexEntry{
+			"copied":  entry(map[string]string{".json": "bad/copied.json"}, "bad/copied"),
+			"badOnly": entry(map[string]string{}, "bad/only"),
+			"old":     entry(map[string]string{}, "bad/changed"),
+		})
+	}()
+
+	logger := hclog.NewNullLogger()
+	if err := SetDifferenceByPath(logger, dbPath, "result", "photos", "bad_import"); err != nil {
+		t.Fatalf("SetDifferenceByPath() error = %v", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if n := entryCount(t, db, "result"); n != 3 {
+		t.Errorf("result has %d entries, want 3", n)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, "result", hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		// The legitimate copy survives without the bad path and its attachment
+		copied, err := getEntry(bucket, []byte("copied"))
+		if err != nil {
+			return err
+		}
+		if copied == nil {
+			t.Fatal("result missing copied")
+		}
+		if _, ok := copied.Paths["good/copied"]; !ok || len(copied.Paths) != 1 {
+			t.Errorf("copied paths = %v, want only good/copied", copied.Paths)
+		}
+		if len(copied.Attachments) != 0 {
+			t.Errorf("copied attachments = %v, want none", copied.Attachments)
+		}
+
+		if bucket.Get([]byte("badOnly")) != nil {
+			t.Error("result has badOnly, which has no paths left")
+		}
+		if bucket.Get([]byte("good")) == nil {
+			t.Error("result missing good")
+		}
+		// The path was imported with other content, so this is a newer file
+		if bucket.Get([]byte("changed")) == nil {
+			t.Error("result missing changed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
+
 func TestSetOperations_Errors(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), DefaultDBPath)
 	logger := hclog.NewNullLogger()
 
 	tests := []struct {
@@ -395,34 +591,40 @@ func TestSetOperations_Errors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name+"_difference", func(t *testing.T) {
-			err := SetDifference(logger, tt.target, tt.indexA, tt.indexB)
+			err := SetDifference(logger, dbPath, tt.target, tt.indexA, tt.indexB)
 			if err == nil {
 				t.Error("SetDifference() expected error for invalid input")
 			}
 		})
 
 		t.Run(tt.name+"_intersection", func(t *testing.T) {
-			err := SetIntersection(logger, tt.target, tt.indexA, tt.indexB)
+			err := SetIntersection(logger, dbPath, tt.target, tt.indexA, tt.indexB)
 			if err == nil {
 				t.Error("SetIntersection() expected error for invalid input")
 			}
 		})
 
 		t.Run(tt.name+"_union", func(t *testing.T) {
-			err := SetUnion(logger, tt.target, tt.indexA, tt.indexB)
+			err := SetUnion(logger, dbPath, tt.target, tt.indexA, tt.indexB)
 			if err == nil {
 				t.Error("SetUnion() expected error for invalid input")
 			}
 		})
 	}
+
+	t.Run("one input", func(t *testing.T) {
+		if err := SetUnion(logger, dbPath, "result", "indexA"); err == nil {
+			t.Error("SetUnion() expected error for a single input")
+		}
+	})
 }
 
 func TestSetOperations_TargetExists(t *testing.T) {
-	initTestDatabase(t)
+	dbPath := initTestDatabase(t)
 
 	// Create a target index that already exists
 	func() {
-		db, err := getDB()
+		db, err := getDB(dbPath)
 		if err != nil {
 			t.Fatalf("failed to open database: %v", err)
 		}
@@ -435,21 +637,21 @@ func TestSetOperations_TargetExists(t *testing.T) {
 	logger := hclog.NewNullLogger()
 
 	t.Run("difference with existing target", func(t *testing.T) {
-		err := SetDifference(logger, "existing", "indexA", "indexB")
+		err := SetDifference(logger, dbPath, "existing", "indexA", "indexB")
 		if err == nil {
 			t.Error("expected error when target index already exists")
 		}
 	})
 
 	t.Run("intersection with existing target", func(t *testing.T) {
-		err := SetIntersection(logger, "existing", "indexA", "indexB")
+		err := SetIntersection(logger, dbPath, "existing", "indexA", "indexB")
 		if err == nil {
 			t.Error("expected error when target index already exists")
 		}
 	})
 
 	t.Run("union with existing target", func(t *testing.T) {
-		err := SetUnion(logger, "existing", "indexA", "indexB")
+		err := SetUnion(logger, dbPath, "existing", "indexA", "indexB")
 		if err == nil {
 			t.Error("expected error when target index already exists")
 		}
@@ -494,7 +696,7 @@ func TestMergeFunction(t *testing.T) {
 		}
 
 		// Merge
-		count, err := merge(firstBucket, secondBucket, targetBucket)
+		count, err := merge(targetBucket, firstBucket, secondBucket)
 		if err != nil {
 			return err
 		}
@@ -565,7 +767,7 @@ func TestIntersectFunction(t *testing.T) {
 		}
 
 		// Intersect
-		count, err := intersect(firstBucket, secondBucket, targetBucket)
+		count, err := intersect(targetBucket, firstBucket, secondBucket)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,372 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Set expression operators, each of which can also be written with the
+// Unicode symbol shown in its String form.
+const (
+	opUnion               = '|'
+	opIntersection        = '&'
+	opDifference          = '-'
+	opSymmetricDifference = '^'
+)
+
+// setOperators maps every accepted operator symbol to its operator.
+var setOperators = map[rune]rune{
+	'|': opUnion, '∪': opUnion,
+	'&': opIntersection, '∩': opIntersection,
+	'-': opDifference, '−': opDifference, '∖': opDifference,
+	'^': opSymmetricDifference, '△': opSymmetricDifference, '⊖': opSymmetricDifference,
+}
+
+// setExpr is a node in a parsed set expression: either an index name or an
+// operator applied to two subexpressions.
+type setExpr struct {
+	name        string
+	op          rune
+	left, right *setExpr
+
+	// bucket is the hashes bucket for a name, filled in when the expression
+	// is bound to a transaction.
+	bucket *bolt.Bucket
+}
+
+// String returns the expression with every operation parenthesized.
+func (e *setExpr) String() string {
+	if e.op == 0 {
+		return e.name
+	}
+	symbol := map[rune]string{
+		opUnion:               "∪",
+		opIntersection:        "∩",
+		opDifference:          "−",
+		opSymmetricDifference: "△",
+	}[e.op]
+	return "(" + e.left.String() + " " + symbol + " " + e.right.String() + ")"
+}
+
+// contains reports whether a hash is in the result of the expression.
+func (e *setExpr) contains(hash []byte) bool {
+	switch e.op {
+	case opUnion:
+		return e.left.contains(hash) || e.right.contains(hash)
+	case opIntersection:
+		return e.left.contains(hash) && e.right.contains(hash)
+	case opDifference:
+		return e.left.contains(hash) && !e.right.contains(hash)
+	case opSymmetricDifference:
+		return e.left.contains(hash) != e.right.contains(hash)
+	}
+	return e.bucket.Get(hash) != nil
+}
+
+// entry returns the entry for a hash in the result of the expression, or nil
+// if the hash isn't in it. Entries found on both sides of a union or an
+// intersection are merged like merge and intersect do, keeping the size and
+// timestamp from the left; a difference keeps the left entry as it is.
+func (e *setExpr) entry(hash []byte) (*indexEntry, error) {
+	if e.op == 0 {
+		return getEntry(e.bucket, hash)
+	}
+
+	left, err := e.left.entry(hash)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == opDifference {
+		if left == nil || e.right.contains(hash) {
+			return nil, nil
+		}
+		return left, nil
+	}
+
+	right, err := e.right.entry(hash)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case left != nil && right != nil:
+		if e.op == opSymmetricDifference {
+			return nil, nil
+		}
+		left.merge(right)
+		return left, nil
+	case e.op == opIntersection:
+		return nil, nil
+	case left != nil:
+		return left, nil
+	}
+	return right, nil
+}
+
+// bind looks up the hashes bucket for every index name in the expression.
+func (e *setExpr) bind(tx *bolt.Tx) error {
+	if e.op != 0 {
+		if err := e.left.bind(tx); err != nil {
+			return err
+		}
+		return e.right.bind(tx)
+	}
+
+	// A write transaction would quietly create a misspelled index
+	if !bucketExistsForIndex(tx, e.name) {
+		return fmt.Errorf("index %q does not exist", e.name)
+	}
+	bucket, err := getBucketForIndex(tx, e.name, hashesBucketKey)
+	if err != nil {
+		return err
+	}
+	e.bucket = bucket
+	return nil
+}
+
+// setToken is a lexical token in a set expression. The kind is a name, an
+// operator, '(' or ')', or 0 at the end of the input.
+type setToken struct {
+	kind rune
+	text string
+	pos  int
+}
+
+// tokenName is the kind of a token holding an index name.
+const tokenName = 'n'
+
+// tokenizeSetExpr splits a set expression into tokens. Index names are runs
+// of letters, digits and any of "_.-:@", and can't start with "-"; names with
+// other characters can be given in double quotes.
+func tokenizeSetExpr(input string) ([]setToken, error) {
+	var tokens []setToken
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(' || r == ')':
+			tokens = append(tokens, setToken{kind: r, text: string(r), pos: i})
+			i += size
+		case setOperators[r] != 0:
+			tokens = append(tokens, setToken{kind: setOperators[r], text: string(r), pos: i})
+			i += size
+		case r == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			name := input[i+1 : i+1+end]
+			if name == "" {
+				return nil, fmt.Errorf("empty index name at position %d", i)
+			}
+			tokens = append(tokens, setToken{kind: tokenName, text: name, pos: i})
+			i += end + 2
+		case isNameRune(r):
+			start := i
+			for i < len(input) {
+				r, size := utf8.DecodeRuneInString(input[i:])
+				if !isNameRune(r) && r != '-' {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, setToken{kind: tokenName, text: input[start:i], pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", r, i)
+		}
+	}
+	return append(tokens, setToken{pos: len(input)}), nil
+}
+
+// isNameRune reports whether r can start an unquoted index name.
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:@", r)
+}
+
+// setParser is a recursive descent parser for set expressions. Intersection
+// binds tighter than union, difference and symmetric difference, which are
+// evaluated left to right.
+type setParser struct {
+	tokens []setToken
+	pos    int
+}
+
+// parseSetExpr parses a set expression over index names.
+func parseSetExpr(input string) (*setExpr, error) {
+	tokens, err := tokenizeSetExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &setParser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return e, nil
+}
+
+func (p *setParser) peek() setToken {
+	return p.tokens[p.pos]
+}
+
+func (p *setParser) next() setToken {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// parseExpr parses terms joined by union, difference or symmetric difference.
+func (p *setParser) parseExpr() (*setExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().kind
+		if op != opUnion && op != opDifference && op != opSymmetricDifference {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &setExpr{op: op, left: left, right: right}
+	}
+}
+
+// parseTerm parses operands joined by intersection.
+func (p *setParser) parseTerm() (*setExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == opIntersection {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &setExpr{op: opIntersection, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseOperand parses an index name or a parenthesized expression.
+func (p *setParser) parseOperand() (*setExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		return &setExpr{name: t.text}, nil
+	case '(':
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != ')' {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos)
+		}
+		return e, nil
+	case 0:
+		return nil, errors.New("expression ended where an index name or '(' was expected")
+	}
+	return nil, fmt.Errorf("expected an index name or '(' at position %d, got %q", t.pos, t.text)
+}
+
+// SetEval creates a new index from a set expression over existing indexes,
+// such as "(phone | camera) - (bad_import | trash)". The whole expression is
+// evaluated hash by hash in a single transaction, without creating any
+// intermediate indexes.
+func SetEval(logger hclog.Logger, dbPath, targetIndex, expression string) error {
+	if targetIndex == "" {
+		return errors.New("target index name cannot be empty")
+	}
+	if strings.TrimSpace(expression) == "" {
+		return errors.New("expression cannot be empty")
+	}
+
+	expr, err := parseSetExpr(expression)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+
+	db, err := getDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucketExistsForIndex(tx, targetIndex) {
+			return fmt.Errorf("target index %q already exists", targetIndex)
+		}
+		if err := expr.bind(tx); err != nil {
+			return err
+		}
+
+		targetBucket, err := getBucketForIndex(tx, targetIndex, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		count, err := evalSetExpr(expr, targetBucket)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("set eval completed", "target", targetIndex, "expression", expr.String(), "entries", count)
+		return nil
+	})
+}
+
+// evalSetExpr writes the result of a bound expression to the target bucket,
+// visiting each hash from the expression's indexes once.
+// Returns the number of entries added to the target.
+func evalSetExpr(expr *setExpr, target *bolt.Bucket) (int, error) {
+	var leaves []*bolt.Bucket
+	var collect func(*setExpr)
+	seen := make(map[string]bool)
+	collect = func(e *setExpr) {
+		if e.op != 0 {
+			collect(e.left)
+			collect(e.right)
+		} else if !seen[e.name] {
+			seen[e.name] = true
+			leaves = append(leaves, e.bucket)
+		}
+	}
+	collect(expr)
+
+	count := 0
+	for i, leaf := range leaves {
+		cursor := leaf.Cursor()
+		for hash, _ := cursor.First(); hash != nil; hash, _ = cursor.Next() {
+			// Each hash is decided at the first index that has it
+			if inAny(hash, leaves[:i]) || !expr.contains(hash) {
+				continue
+			}
+
+			entry, err := expr.entry(hash)
+			if err != nil {
+				return count, fmt.Errorf("failed to get entry: %w", err)
+			}
+			if err := putEntry(target, hash, entry); err != nil {
+				return count, fmt.Errorf("failed to put entry: %w", err)
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseSetExpr(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"a", "a", false},
+		{"a | b", "(a ∪ b)", false},
+		{"a ∪ b ∩ c", "(a ∪ (b ∩ c))", false},
+		{"a - b - c", "((a − b) − c)", false},
+		{"(phone ∪ camera) − (bad_import ∪ trash)", "((phone ∪ camera) − (bad_import ∪ trash))", false},
+		{"a ^ b & c", "(a △ (b ∩ c))", false},
+		{"a△b", "(a △ b)", false},
+		{"camera-2019 - trash", "(camera-2019 − trash)", false},
+		{`"my photos" | b`, "(my photos ∪ b)", false},
+		{"((a))", "a", false},
+		{"", "", true},
+		{"a |", "", true},
+		{"| a", "", true},
+		{"a b", "", true},
+		{"(a | b", "", true},
+		{"a | b)", "", true},
+		{`"a`, "", true},
+		{`""`, "", true},
+		{"a * b", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSetExpr(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSetExpr(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parseSetExpr(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetEval(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	entry := func(path string) *indexEntry {
+		return &indexEntry{
+			Paths:       map[string]struct{}{path: {}},
+			Attachments: map[string]string{},
+			Size:        100,
+			Timestamp:   time.Now(),
+		}
+	}
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "phone", map[string]*indexEntry{
+			"keep1": entry("phone/keep1"),
+			"bad":   entry("phone/bad"),
+			"both":  entry("phone/both"),
+		})
+		createTestIndex(t, db, "camera", map[string]*indexEntry{
+			"keep2": entry("camera/keep2"),
+			"trash": entry("camera/trash"),
+			"both":  entry("camera/both"),
+		})
+		createTestIndex(t, db, "bad_import", map[string]*indexEntry{
+			"bad": entry("bad_import/bad"),
+		})
+		createTestIndex(t, db, "trash", map[string]*indexEntry{
+			"trash": entry("trash/trash"),
+		})
+	}()
+
+	logger := hclog.NewNullLogger()
+	tests := []struct {
+		target string
+		expr   string
+		want   map[string]int
+	}{
+		{"cleaned", "(phone ∪ camera) − (bad_import ∪ trash)", map[string]int{"keep1": 1, "keep2": 1, "both": 2}},
+		{"common", "phone & camera", map[string]int{"both": 2}},
+		{"either", "phone ^ camera", map[string]int{"keep1": 1, "bad": 1, "keep2": 1, "trash": 1}},
+		{"self", "phone | phone", map[string]int{"keep1": 1, "bad": 1, "both": 1}},
+		{"empty", "trash - camera", map[string]int{}},
+	}
+	for _, tt := range tests {
+		if err := SetEval(logger, dbPath, tt.target, tt.expr); err != nil {
+			t.Fatalf("SetEval(%q) error = %v", tt.expr, err)
+		}
+	}
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		for _, tt := range tests {
+			if n := entryCount(t, db, tt.target); n != len(tt.want) {
+				t.Errorf("%s has %d entries, want %d", tt.target, n, len(tt.want))
+			}
+			err := db.View(func(tx *bolt.Tx) error {
+				bucket, err := getBucketForIndex(tx, tt.target, hashesBucketKey)
+				if err != nil {
+					return err
+				}
+				for hash, paths := range tt.want {
+					e, err := getEntry(bucket, []byte(hash))
+					if err != nil {
+						return err
+					}
+					if e == nil {
+						t.Errorf("%s missing %s", tt.target, hash)
+					} else if len(e.Paths) != paths {
+						t.Errorf("%s %s has %d paths, want %d", tt.target, hash, len(e.Paths), paths)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("verification error = %v", err)
+			}
+		}
+	}()
+
+	// Errors leave no trace of the target or a misspelled index
+	if err := SetEval(logger, dbPath, "typo", "phone - tarsh"); err == nil {
+		t.Error("expected error for a missing index")
+	}
+	if err := SetEval(logger, dbPath, "cleaned", "phone"); err == nil {
+		t.Error("expected error when the target exists")
+	}
+	if err := SetEval(logger, dbPath, "broken", "phone -"); err == nil {
+		t.Error("expected error for an invalid expression")
+	}
+	if err := SetEval(logger, dbPath, "", "phone"); err == nil {
+		t.Error("expected error for an empty target")
+	}
+	db, err := getDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{"typo", "tarsh", "broken"} {
+			if bucketExistsForIndex(tx, name) {
+				t.Errorf("index %q was created", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verification error = %v", err)
+	}
+}
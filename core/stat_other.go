@@ -0,0 +1,16 @@
+//go:build !unix
+
+package core
+
+import "os"
+
+// fileInode returns zero since inode numbers are not available on this
+// platform; size and modification time still detect changed files.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
+
+// fileDevice reports that filesystem IDs are not available on this platform.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// tmpFilePrefix starts the name of every temporary file venn writes before
+// renaming it into place.
+const tmpFilePrefix = ".venn-tmp-"
+
+// syncSummary counts what a sync removed from a materialized tree.
+type syncSummary struct {
+	extras  int
+	bytes   int64
+	tmps    int
+	dirs    int
+	skipped int
+}
+
+// syncMaterialized removes every file under a materialized root that isn't
+// one of the planned items, their attachments or the manifest. Extras are
+// moved into the quarantine directory if one is given, otherwise deleted.
+// Leftover temporary files are always deleted, and folders left empty are
+// removed. With dryRun, what would be removed is printed instead.
+func syncMaterialized(logger hclog.Logger, rootPath string, items []*materializeItem, quarantine string, dryRun bool) error {
+	expected := map[string]bool{
+		filepath.Join(rootPath, materializeManifestName): true,
+	}
+	for _, item := range items {
+		dst := filepath.Join(rootPath, item.dst)
+		expected[dst] = true
+		for ext := range item.entry.Attachments {
+			expected[attachmentPath(dst, ext)] = true
+		}
+	}
+
+	var absQuarantine string
+	if quarantine != "" {
+		var err error
+		if absQuarantine, err = filepath.Abs(quarantine); err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+	}
+
+	var (
+		summary syncSummary
+		dirs    []string
+	)
+	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A dry run can come before the root is ever created
+			if dryRun && path == rootPath && os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Don't sweep up the quarantine if it's inside the tree
+			if absQuarantine != "" {
+				if abs, err := filepath.Abs(path); err == nil && abs == absQuarantine {
+					return filepath.SkipDir
+				}
+			}
+			if path != rootPath {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if expected[path] {
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), tmpFilePrefix) {
+			if dryRun {
+				fmt.Printf("remove %s\n", path)
+				summary.tmps++
+				return nil
+			}
+			logger.Debug("removing temporary file", "path", path)
+			if err := os.Remove(path); err != nil {
+				logger.Warn("failed to remove temporary file", "path", path, "error", err)
+				summary.skipped++
+				return nil
+			}
+			summary.tmps++
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			if quarantine == "" {
+				fmt.Printf("delete %s\n", path)
+			} else if dst, err := quarantinePath(rootPath, path, quarantine); err == nil {
+				fmt.Printf("quarantine %s -> %s\n", path, dst)
+			}
+			summary.extras++
+			summary.bytes += info.Size()
+			return nil
+		}
+		if err := removeExtra(logger, rootPath, path, info, quarantine); err != nil {
+			logger.Warn("failed to remove extra file", "path", path, "error", err)
+			summary.skipped++
+			return nil
+		}
+		summary.extras++
+		summary.bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk %q: %w", rootPath, err)
+	}
+
+	verb := "deleted"
+	if quarantine != "" {
+		verb = "quarantined"
+	}
+	if dryRun {
+		fmt.Printf("%d extra files would be %s (%d bytes), %d temporary files would be removed\n",
+			summary.extras, verb, summary.bytes, summary.tmps)
+		return nil
+	}
+
+	// Remove folders left empty, deepest first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err == nil {
+				summary.dirs++
+			}
+		}
+	}
+
+	fmt.Printf("%d extra files %s (%d bytes), %d temporary files and %d empty folders removed, %d skipped\n",
+		summary.extras, verb, summary.bytes, summary.tmps, summary.dirs, summary.skipped)
+	return nil
+}
+
+// removeExtra deletes a file that doesn't belong in a materialized tree, or
+// moves it into the quarantine directory at the same relative path.
+func removeExtra(logger hclog.Logger, rootPath, path string, info os.FileInfo, quarantine string) error {
+	if quarantine == "" {
+		logger.Debug("deleting extra file", "path", path)
+		return os.Remove(path)
+	}
+
+	dst, err := quarantinePath(rootPath, path, quarantine)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("quarantine path %q already exists", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), materializedDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	logger.Debug("quarantining extra file", "path", path, "quarantine", dst)
+	return moveFile(nil, path, dst, info.ModTime())
+}
+
+// quarantinePath returns where an extra file under a materialized root is
+// moved in the quarantine directory, at the same relative path.
+func quarantinePath(rootPath, path, quarantine string) (string, error) {
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+	return filepath.Join(quarantine, rel), nil
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestMaterialize_Sync(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "output")
+	indexData := make(map[string]*indexEntry)
+	dsts := make(map[string]string)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		filePath := filepath.Join(tmpDir, name)
+		content := []byte("content of " + name)
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		hash := sha256.Sum256(content)
+		indexData[string(hash[:])] = &indexEntry{
+			Paths:       map[string]struct{}{filePath: {}},
+			Attachments: map[string]string{},
+			Size:        int64(len(content)),
+			Timestamp:   time.Now(),
+		}
+		dsts[name] = filepath.Join(outputDir, fmt.Sprintf("%02x", hash[0]), fmt.Sprintf("%02x", hash[1]), fmt.Sprintf("%x.txt", hash))
+	}
+
+	func() {
+		db, err := getDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		createTestIndex(t, db, "test-index", indexData)
+	}()
+
+	logger := hclog.NewNullLogger()
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+
+	// Corrupt one file and leave an extra file, an orphaned temporary file
+	// and a folder that only holds an extra file
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	write(dsts["a.txt"], "bit rot")
+	extra := filepath.Join(outputDir, "extra.txt")
+	write(extra, "not in the index")
+	orphan := filepath.Join(filepath.Dir(dsts["b.txt"]), ".venn-tmp-123")
+	write(orphan, "partial copy")
+	extraDir := filepath.Join(outputDir, "zz")
+	write(filepath.Join(extraDir, "old.txt"), "also not in the index")
+
+	// Plain runs trust what's there
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{}); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dsts["a.txt"]); string(got) != "bit rot" {
+		t.Errorf("plain run changed an existing file to %q", got)
+	}
+
+	// A dry run lists what would go without touching anything
+	quarantine := filepath.Join(tmpDir, "quarantine")
+	dryRun := MaterializeOptions{Sync: true, Quarantine: quarantine, DryRun: true}
+	if err := Materialize(logger, dbPath, "test-index", outputDir, dryRun); err != nil {
+		t.Fatalf("Materialize() with sync dry run error = %v", err)
+	}
+	for _, path := range []string{extra, orphan, extraDir} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("dry run removed %s: %v", path, err)
+		}
+	}
+	if got, _ := os.ReadFile(dsts["a.txt"]); string(got) != "bit rot" {
+		t.Errorf("dry run changed an existing file to %q", got)
+	}
+	if _, err := os.Stat(quarantine); !os.IsNotExist(err) {
+		t.Errorf("dry run created the quarantine: %v", err)
+	}
+
+	opts := MaterializeOptions{Sync: true, Quarantine: quarantine}
+	if err := Materialize(logger, dbPath, "test-index", outputDir, opts); err != nil {
+		t.Fatalf("Materialize() with sync error = %v", err)
+	}
+
+	if got, _ := os.ReadFile(dsts["a.txt"]); string(got) != "content of a.txt" {
+		t.Errorf("corrupt file content after sync = %q", got)
+	}
+	if _, err := os.Stat(dsts["b.txt"]); err != nil {
+		t.Errorf("sync removed b.txt: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, materializeManifestName)); err != nil {
+		t.Errorf("sync removed the manifest: %v", err)
+	}
+	for _, path := range []string{extra, orphan, extraDir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("sync left %s behind: %v", path, err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(quarantine, "extra.txt")); string(got) != "not in the index" {
+		t.Errorf("quarantined extra content = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(quarantine, filepath.Base(orphan))); !os.IsNotExist(err) {
+		t.Errorf("temporary file was quarantined rather than removed: %v", err)
+	}
+
+	// Without a quarantine, extras are deleted
+	write(extra, "not in the index")
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{Sync: true}); err != nil {
+		t.Fatalf("Materialize() with sync error = %v", err)
+	}
+	if _, err := os.Stat(extra); !os.IsNotExist(err) {
+		t.Errorf("sync left %s behind: %v", extra, err)
+	}
+
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{Quarantine: quarantine}); err == nil {
+		t.Error("Materialize() with a quarantine but no sync should fail")
+	}
+	if err := Materialize(logger, dbPath, "test-index", outputDir, MaterializeOptions{DryRun: true}); err == nil {
+		t.Error("Materialize() with a dry run but no sync should fail")
+	}
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrVerifyFailed indicates that a verify run found files that don't match
+// the index.
+var ErrVerifyFailed = errors.New("verification found problems")
+
+// Verify statuses for files that don't match the index.
+const (
+	VerifyMissing      = "missing"
+	VerifyUnreadable   = "unreadable"
+	VerifySizeMismatch = "size_mismatch"
+	VerifyChanged      = "changed"
+)
+
+// VerifyOptions controls how an index is checked against the disk.
+type VerifyOptions struct {
+	// Sample is the percentage of paths to check, chosen at random on each
+	// run. Zero or 100 checks every path.
+	Sample float64
+
+	// Quick compares sizes and modification times instead of re-hashing.
+	// Modification times can only be checked for paths that were scanned
+	// with a path record, such as by index add-files.
+	Quick bool
+
+	// Workers is the number of files to hash in parallel. Zero or less uses
+	// one worker per CPU.
+	Workers int
+}
+
+// verifyJob is one path to check.
+type verifyJob struct {
+	hash       []byte
+	path       string
+	size       int64
+	attachment bool
+	record     *pathEntry
+}
+
+// verifyProblem is a path that doesn't match the index.
+type verifyProblem struct {
+	Status string `json:"status"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Detail string `json:"detail"`
+}
+
+// IndexVerify re-reads every path and attachment in an index and reports the
+// ones that are missing, unreadable, or no longer have the indexed size or
+// hash. Attachments are only checked for being readable, since they aren't
+// hashed. It returns an error wrapping ErrVerifyFailed if any problems were
+// found.
+func IndexVerify(logger hclog.Logger, dbPath, indexName string, opts VerifyOptions, format OutputFormat) error {
+	if indexName == "" {
+		return errors.New("index name cannot be empty")
+	}
+	if opts.Sample < 0 || opts.Sample > 100 {
+		return fmt.Errorf("sample must be a percentage between 0 and 100, not %g", opts.Sample)
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs, err := loadVerifyJobs(dbPath, indexName, opts)
+	if err != nil {
+		return err
+	}
+
+	problems := checkInParallel(logger, jobs, workers, func(job *verifyJob) *verifyProblem {
+		return verifyPath(job, opts.Quick)
+	})
+
+	counts, err := writeVerifyProblems(problems, format)
+	if err != nil {
+		return err
+	}
+	if format == FormatTable {
+		fmt.Println()
+		fmt.Printf("%d paths checked: %d missing, %d unreadable, %d size mismatches, %d changed\n",
+			len(jobs), counts[VerifyMissing], counts[VerifyUnreadable], counts[VerifySizeMismatch], counts[VerifyChanged])
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d of %d paths", ErrVerifyFailed, len(problems), len(jobs))
+	}
+	return nil
+}
+
+// checkInParallel runs check over every job with a pool of workers, and
+// returns the problems it found sorted by path.
+func checkInParallel[T any](logger hclog.Logger, jobs []T, workers int, check func(T) *verifyProblem) []verifyProblem {
+	bar := pb.StartNew(len(jobs))
+	defer bar.Finish()
+
+	queue := make(chan T, workers)
+	go func() {
+		defer close(queue)
+		for _, job := range jobs {
+			queue <- job
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		problems []verifyProblem
+		wg       sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				problem := check(job)
+				bar.Increment()
+				if problem == nil {
+					continue
+				}
+				logger.Debug("verify problem", "path", problem.Path, "status", problem.Status)
+				mu.Lock()
+				problems = append(problems, *problem)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems
+}
+
+// writeVerifyProblems prints a verify report to stdout and returns the number
+// of problems with each status.
+func writeVerifyProblems(problems []verifyProblem, format OutputFormat) (map[string]int, error) {
+	header := []string{"Status", "Path", "SHA-256", "Detail"}
+	if format == FormatCSV {
+		header = []string{"status", "path", "sha256", "detail"}
+	}
+	out, err := newRecordWriter(os.Stdout, format, header)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, p := range problems {
+		counts[p.Status]++
+		if err := out.write(p, []string{p.Status, p.Path, p.SHA256, p.Detail}); err != nil {
+			return nil, err
+		}
+	}
+	if err := out.close(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// loadVerifyJobs reads the paths to check from an index, applying the sample,
+// and closes the database so slow file reads don't hold it open.
+func loadVerifyJobs(dbPath, indexName string, opts VerifyOptions) ([]*verifyJob, error) {
+	db, err := getDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	sampled := func() bool {
+		return opts.Sample == 0 || opts.Sample == 100 || rand.Float64()*100 < opts.Sample
+	}
+
+	var jobs []*verifyJob
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket, err := getBucketForIndex(tx, indexName, hashesBucketKey)
+		if err != nil {
+			return err
+		}
+
+		// Indexes built by set operations or older versions have no path
+		// records, which only limits what a quick check can compare
+		pathsBucket, err := getBucketForIndex(tx, indexName, pathsBucketKey)
+		if err != nil && !errors.Is(err, ErrIndexNotWellFormed) {
+			return err
+		}
+
+		cursor := bucket.Cursor()
+		for hash, entryData := cursor.First(); hash != nil; hash, entryData = cursor.Next() {
+			entry, err := decodeEntry(entryData)
+			if err != nil {
+				return fmt.Errorf("failed to decode entry: %w", err)
+			}
+			hash := append([]byte(nil), hash...)
+
+			for _, p := range sortedPaths(entry) {
+				if !sampled() {
+					continue
+				}
+				job := &verifyJob{hash: hash, path: p, size: entry.Size}
+				if pathsBucket != nil && opts.Quick {
+					record, err := getPathEntry(pathsBucket, p)
+					if err != nil {
+						return err
+					}
+					// A record from another hash belongs to a newer scan
+					if record != nil && bytes.Equal(record.Hash, hash) {
+						job.record = record
+					}
+				}
+				jobs = append(jobs, job)
+			}
+			for _, p := range entry.Attachments {
+				if sampled() {
+					jobs = append(jobs, &verifyJob{hash: hash, path: p, attachment: true})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// verifyPath checks one path, returning nil if it matches the index.
+func verifyPath(job *verifyJob, quick bool) *verifyProblem {
+	problem := func(status, detail string) *verifyProblem {
+		return &verifyProblem{
+			Status: status,
+			Path:   job.path,
+			SHA256: hex.EncodeToString(job.hash),
+			Detail: detail,
+		}
+	}
+
+	info, err := os.Stat(job.path)
+	if os.IsNotExist(err) {
+		return problem(VerifyMissing, "")
+	}
+	if err != nil {
+		return problem(VerifyUnreadable, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return problem(VerifyUnreadable, "not a regular file")
+	}
+
+	if job.attachment {
+		f, err := os.Open(job.path)
+		if err != nil {
+			return problem(VerifyUnreadable, err.Error())
+		}
+		f.Close()
+		return nil
+	}
+
+	if info.Size() != job.size {
+		return problem(VerifySizeMismatch, fmt.Sprintf("%d bytes, indexed as %d", info.Size(), job.size))
+	}
+
+	if quick {
+		if job.record != nil && !job.record.ModTime.Equal(info.ModTime()) {
+			return problem(VerifyChanged, "modification time changed since it was indexed")
+		}
+		return nil
+	}
+
+	hash, err := hashFile(job.path)
+	if err != nil {
+		return problem(VerifyUnreadable, err.Error())
+	}
+	if !bytes.Equal(hash, job.hash) {
+		return problem(VerifyChanged, "now has hash "+hex.EncodeToString(hash))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestIndexVerify(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	write("keep.txt", "keep")
+	write("delete.txt", "delete")
+	write("rot.txt", "original")
+	write("grow.txt", "grow")
+
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	if err := IndexVerify(logger, dbPath, "test-index", VerifyOptions{}, FormatTable); err != nil {
+		t.Fatalf("IndexVerify() of a fresh index error = %v", err)
+	}
+
+	// Bit rot keeps the size and modification time but changes the content
+	rot := filepath.Join(tmpDir, "rot.txt")
+	info, err := os.Stat(rot)
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+	write("rot.txt", "0riginal")
+	if err := os.Chtimes(rot, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to set times: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tmpDir, "delete.txt")); err != nil {
+		t.Fatalf("failed to remove test file: %v", err)
+	}
+	write("grow.txt", "grown bigger")
+
+	jobs, err := loadVerifyJobs(dbPath, "test-index", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("loadVerifyJobs() error = %v", err)
+	}
+	want := map[string]string{
+		"keep.txt":   "",
+		"delete.txt": VerifyMissing,
+		"rot.txt":    VerifyChanged,
+		"grow.txt":   VerifySizeMismatch,
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("loadVerifyJobs() returned %d jobs, want %d", len(jobs), len(want))
+	}
+	for _, job := range jobs {
+		status := ""
+		if problem := verifyPath(job, false); problem != nil {
+			status = problem.Status
+		}
+		if name := filepath.Base(job.path); status != want[name] {
+			t.Errorf("%s status = %q, want %q", name, status, want[name])
+		}
+
+		// A quick check can't see bit rot
+		if filepath.Base(job.path) == "rot.txt" {
+			if problem := verifyPath(job, true); problem != nil {
+				t.Errorf("quick check of rot.txt = %+v, want no problem", problem)
+			}
+		}
+	}
+
+	err = IndexVerify(logger, dbPath, "test-index", VerifyOptions{Workers: 2}, FormatJSONL)
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("IndexVerify() error = %v, want ErrVerifyFailed", err)
+	}
+}
+
+func TestIndexVerify_Quick(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "touched.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("failed to set times: %v", err)
+	}
+
+	err := IndexVerify(logger, dbPath, "test-index", VerifyOptions{Quick: true}, FormatTable)
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("quick IndexVerify() error = %v, want ErrVerifyFailed", err)
+	}
+	if err := IndexVerify(logger, dbPath, "test-index", VerifyOptions{}, FormatTable); err != nil {
+		t.Errorf("full IndexVerify() error = %v, want the content to match", err)
+	}
+}
+
+func TestIndexVerify_Sample(t *testing.T) {
+	dbPath := initTestDatabase(t)
+
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	logger := hclog.NewNullLogger()
+	if err := IndexAddFiles(logger, dbPath, "test-index", tmpDir, IndexAddOptions{}); err != nil {
+		t.Fatalf("IndexAddFiles() error = %v", err)
+	}
+
+	for sample, want := range map[float64]int{0: 3, 100: 3, 0.0000001: 0} {
+		jobs, err := loadVerifyJobs(dbPath, "test-index", VerifyOptions{Sample: sample})
+		if err != nil {
+			t.Fatalf("loadVerifyJobs() error = %v", err)
+		}
+		// The tiny sample could in theory pick a path, but never all of them
+		if (want == 3 && len(jobs) != 3) || (want == 0 && len(jobs) == 3) {
+			t.Errorf("sample %g gave %d jobs, want %d", sample, len(jobs), want)
+		}
+	}
+
+	for _, sample := range []float64{-1, 101} {
+		if err := IndexVerify(logger, dbPath, "test-index", VerifyOptions{Sample: sample}, FormatTable); err == nil {
+			t.Errorf("IndexVerify() with sample %g should fail", sample)
+		}
+	}
+}
@@ -11,6 +11,7 @@ package e2e
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -179,6 +180,57 @@ func TestFullWorkflow(t *testing.T) {
 		t.Errorf("stats D: exit %d, stdout:\n%s", r.code, r.stdout)
 	}
 
+	// Set operations take any number of inputs.
+	if r := runVenn(t, wd, "set", "intersection", "I3", "A", "B", "U"); r.code != 0 {
+		t.Fatalf("set intersection of three: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "stats", "I3"); r.code != 0 || !strings.Contains(r.stdout, "1 hashes for 2 files") {
+		t.Errorf("stats I3: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+
+	// An expression needs no intermediate indexes.
+	if r := runVenn(t, wd, "set", "eval", "E", "(A | B) - (B - A)"); r.code != 0 {
+		t.Fatalf("set eval: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "stats", "E"); r.code != 0 || !strings.Contains(r.stdout, "2 hashes for 3 files") {
+		t.Errorf("stats E: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+
+	// Undoing B by path keeps A's copy of the shared file.
+	if r := runVenn(t, wd, "set", "difference", "--by-path", "P", "U", "B"); r.code != 0 {
+		t.Fatalf("set difference --by-path: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "stats", "P"); r.code != 0 || !strings.Contains(r.stdout, "2 hashes for 2 files (0 hashes with duplicates)") {
+		t.Errorf("stats P: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+
+	// Symmetric difference keeps what is unique to each side.
+	if r := runVenn(t, wd, "set", "symmetric-difference", "S", "A", "B"); r.code != 0 {
+		t.Fatalf("set symmetric-difference: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "stats", "S"); r.code != 0 || !strings.Contains(r.stdout, "2 hashes for 2 files") {
+		t.Errorf("stats S: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+	compare := runVenn(t, wd, "index", "compare", "--format", "json", "A", "B")
+	if compare.code != 0 {
+		t.Fatalf("index compare: exit %d, stderr:\n%s", compare.code, compare.stderr)
+	}
+	type group struct {
+		Hashes int   `json:"hashes"`
+		Bytes  int64 `json:"bytes"`
+	}
+	var counts struct {
+		OnlyA group `json:"only_a"`
+		OnlyB group `json:"only_b"`
+		Both  group `json:"both"`
+	}
+	if err := json.Unmarshal([]byte(compare.stdout), &counts); err != nil {
+		t.Fatalf("index compare json: %v\n%s", err, compare.stdout)
+	}
+	if counts.OnlyA.Hashes != 1 || counts.OnlyB.Hashes != 1 || counts.Both != (group{1, int64(len(shared))}) {
+		t.Errorf("index compare = %+v", counts)
+	}
+
 	// index cat U lists all three hashes.
 	catU := runVenn(t, wd, "index", "cat", "U")
 	if catU.code != 0 {
@@ -298,6 +350,368 @@ func TestChunkAndDelete(t *testing.T) {
 	}
 }
 
+// TestRefresh re-scans a tree after adding, editing and deleting files and
+// checks the printed summary and the resulting index.
+func TestRefresh(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/keep.dat", "kept content")
+	writeFile(t, wd, "tree/edit.dat", "original content")
+	writeFile(t, wd, "tree/gone.dat", "deleted content")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	writeFile(t, wd, "tree/edit.dat", "edited content, now longer")
+	writeFile(t, wd, "tree/new.dat", "new content")
+	if err := os.Remove(filepath.Join(wd, "tree/gone.dat")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	r := runVenn(t, wd, "index", "refresh", "idx", "tree")
+	if r.code != 0 {
+		t.Fatalf("refresh: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if !strings.Contains(r.stdout, "1 paths added, 1 paths changed, 1 paths removed") {
+		t.Errorf("refresh: stdout missing summary:\n%s", r.stdout)
+	}
+	if r := runVenn(t, wd, "index", "stats", "idx"); r.code != 0 || !strings.Contains(r.stdout, "3 hashes for 3 files") {
+		t.Errorf("stats idx: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+}
+
+// TestDBLocation keeps the database outside the working directory and checks
+// that --db and VENN_DB both reach it.
+func TestDBLocation(t *testing.T) {
+	wd := t.TempDir()
+	dbPath := filepath.Join(t.TempDir(), "project.db")
+
+	if r := runVenn(t, wd, "--db", dbPath, "init"); r.code != 0 {
+		t.Fatalf("init: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	writeFile(t, wd, "tree/a.dat", "some content")
+	if r := runVenn(t, wd, "--db", dbPath, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(wd, "venn.db")); err == nil {
+		t.Error("venn.db was created in the working directory")
+	}
+
+	cmd := exec.Command(vennBin, "index", "ls")
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), "VENN_DB="+dbPath)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("index ls with VENN_DB: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "idx" {
+		t.Errorf("index ls with VENN_DB = %q, want idx", out)
+	}
+}
+
+// TestOutputFormats checks that cat, ls and stats print parseable JSON and
+// that jsonl writes one object per entry.
+func TestOutputFormats(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/a.dat", "first content")
+	writeFile(t, wd, "tree/b.dat", "second content")
+	writeFile(t, wd, "tree/c.dat", "second content")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	r := runVenn(t, wd, "index", "cat", "idx", "--format", "json")
+	if r.code != 0 {
+		t.Fatalf("cat json: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	var entries []struct {
+		SHA256 string   `json:"sha256"`
+		Paths  []string `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &entries); err != nil {
+		t.Fatalf("cat json: invalid JSON: %v\n%s", err, r.stdout)
+	}
+	if len(entries) != 2 {
+		t.Errorf("cat json: got %d entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if e.SHA256 == sha256hex("second content") && len(e.Paths) != 2 {
+			t.Errorf("cat json: duplicate entry has paths %v, want 2", e.Paths)
+		}
+	}
+
+	r = runVenn(t, wd, "index", "cat", "--format=jsonl", "idx")
+	if lines := strings.Split(strings.TrimSpace(r.stdout), "\n"); r.code != 0 || len(lines) != 2 {
+		t.Errorf("cat jsonl: exit %d, stdout:\n%s", r.code, r.stdout)
+	}
+
+	r = runVenn(t, wd, "index", "ls", "--format", "json")
+	var names []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &names); r.code != 0 || err != nil || len(names) != 1 || names[0].Name != "idx" {
+		t.Errorf("ls json: exit %d, err %v, stdout:\n%s", r.code, err, r.stdout)
+	}
+
+	r = runVenn(t, wd, "index", "stats", "--format", "json", "idx")
+	var stats struct {
+		Hashes int `json:"hashes"`
+		Files  int `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &stats); r.code != 0 || err != nil || stats.Hashes != 2 || stats.Files != 3 {
+		t.Errorf("stats json: exit %d, err %v, stdout:\n%s", r.code, err, r.stdout)
+	}
+
+	if r := runVenn(t, wd, "index", "cat", "--format", "xml", "idx"); r.code != 1 {
+		t.Errorf("cat xml: exit %d, want 1", r.code)
+	}
+}
+
+// TestDupes lists the duplicated hashes of an index as a table and as JSON.
+func TestDupes(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/unique.dat", "unique content")
+	writeFile(t, wd, "tree/a/dup.dat", "duplicated content")
+	writeFile(t, wd, "tree/b/dup.dat", "duplicated content")
+	writeFile(t, wd, "tree/c/dup.dat", "duplicated content")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	r := runVenn(t, wd, "index", "dupes", "idx")
+	if r.code != 0 {
+		t.Fatalf("dupes: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if strings.Contains(r.stdout, sha256hex("unique content")) || !strings.Contains(r.stdout, sha256hex("duplicated content")) {
+		t.Errorf("dupes: wrong hashes listed:\n%s", r.stdout)
+	}
+	wasted := 2 * len("duplicated content")
+	if !strings.Contains(r.stdout, fmt.Sprintf("1 duplicated hashes; %d bytes wasted", wasted)) {
+		t.Errorf("dupes: stdout missing summary:\n%s", r.stdout)
+	}
+
+	r = runVenn(t, wd, "index", "dupes", "--format", "json", "idx")
+	var dupes []struct {
+		Paths       []string `json:"paths"`
+		WastedBytes int      `json:"wasted_bytes"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &dupes); r.code != 0 || err != nil {
+		t.Fatalf("dupes json: exit %d, err %v, stdout:\n%s", r.code, err, r.stdout)
+	}
+	if len(dupes) != 1 || len(dupes[0].Paths) != 3 || dupes[0].WastedBytes != wasted {
+		t.Errorf("dupes json = %+v", dupes)
+	}
+}
+
+// TestVerify covers the exit codes that cron-driven bit-rot checks rely on.
+func TestVerify(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/a.dat", "first")
+	writeFile(t, wd, "tree/b.dat", "second")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	r := runVenn(t, wd, "index", "verify", "idx")
+	if r.code != 0 || !strings.Contains(r.stdout, "2 paths checked: 0 missing") {
+		t.Fatalf("verify clean: exit %d, stdout:\n%s\nstderr:\n%s", r.code, r.stdout, r.stderr)
+	}
+
+	if err := os.Remove(filepath.Join(wd, "tree", "a.dat")); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	r = runVenn(t, wd, "index", "verify", "--format", "jsonl", "idx")
+	if r.code != 2 {
+		t.Fatalf("verify with a missing file: exit %d, want 2, stderr:\n%s", r.code, r.stderr)
+	}
+	var problem struct {
+		Status string `json:"status"`
+		Path   string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &problem); err != nil || problem.Status != "missing" {
+		t.Errorf("verify jsonl = %q (err %v)", r.stdout, err)
+	}
+
+	if r := runVenn(t, wd, "index", "verify", "nope"); r.code != 1 {
+		t.Errorf("verify of a missing index: exit %d, want 1", r.code)
+	}
+}
+
+func TestMaterializedVerify(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/a.dat", "first")
+	writeFile(t, wd, "tree/b.dat", "second")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "materialize", "idx", "out"); r.code != 0 {
+		t.Fatalf("materialize: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	r := runVenn(t, wd, "materialized", "verify", "idx", "out")
+	if r.code != 0 || !strings.Contains(r.stdout, "2 files checked: 0 corrupt") {
+		t.Fatalf("verify clean: exit %d, stdout:\n%s\nstderr:\n%s", r.code, r.stdout, r.stderr)
+	}
+
+	// Rot a file in place; the originals aren't needed to spot it
+	h := sha256hex("first")
+	writeFile(t, wd, filepath.Join("out", h[:2], h[2:4], h+".dat"), "f1rst")
+	if err := os.RemoveAll(filepath.Join(wd, "tree")); err != nil {
+		t.Fatalf("remove originals: %v", err)
+	}
+	r = runVenn(t, wd, "materialized", "verify", "--format", "jsonl", "idx", "out")
+	if r.code != 2 {
+		t.Fatalf("verify with a corrupt file: exit %d, want 2, stderr:\n%s", r.code, r.stderr)
+	}
+	var problem struct {
+		Status string `json:"status"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &problem); err != nil || problem.Status != "corrupt" || problem.SHA256 != h {
+		t.Errorf("verify jsonl = %q (err %v)", r.stdout, err)
+	}
+}
+
+func TestAddMaterialized(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/a.dat", "first")
+	writeFile(t, wd, "tree/b.dat", "second")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "materialize", "idx", "out"); r.code != 0 {
+		t.Fatalf("materialize: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if err := os.RemoveAll(filepath.Join(wd, "tree")); err != nil {
+		t.Fatalf("remove originals: %v", err)
+	}
+
+	// The backup can be indexed from its names alone, and checks out
+	// against the index it produces
+	if r := runVenn(t, wd, "index", "add-materialized", "backup", "out"); r.code != 0 {
+		t.Fatalf("add-materialized: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	r := runVenn(t, wd, "materialized", "verify", "backup", "out")
+	if r.code != 0 || !strings.Contains(r.stdout, "2 files checked: 0 corrupt") {
+		t.Fatalf("verify backup: exit %d, stdout:\n%s\nstderr:\n%s", r.code, r.stdout, r.stderr)
+	}
+}
+
+// TestIndexFilter splits an index by size and by location without rescanning,
+// and checks that a missing --where prints usage.
+func TestIndexFilter(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	big := strings.Repeat("big file content ", 100)
+	writeFile(t, wd, "tree/DCIM/big.dat", big)
+	writeFile(t, wd, "tree/DCIM/small.dat", "small")
+	writeFile(t, wd, "tree/docs/other.dat", "other")
+	if r := runVenn(t, wd, "index", "add-files", "all", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+
+	if r := runVenn(t, wd, "index", "filter", "big", "all", "--where", "size > 1KB"); r.code != 0 {
+		t.Fatalf("filter big: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "filter", "--where", `path glob "**/DCIM/**"`, "--where", "size < 1KB", "camera_small", "all"); r.code != 0 {
+		t.Fatalf("filter camera_small: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	for name, want := range map[string]string{"big": big, "camera_small": "small"} {
+		r := runVenn(t, wd, "index", "cat", name)
+		if r.code != 0 {
+			t.Fatalf("cat %s: exit %d, stderr:\n%s", name, r.code, r.stderr)
+		}
+		if !strings.Contains(r.stdout, sha256hex(want)) || strings.Count(r.stdout, "tree/") != 1 {
+			t.Errorf("cat %s should list only %s:\n%s", name, sha256hex(want), r.stdout)
+		}
+	}
+
+	r := runVenn(t, wd, "index", "filter", "none", "all")
+	if r.code != 1 || !strings.Contains(r.stderr, "Usage: venn index filter") {
+		t.Errorf("filter without --where: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "filter", "bad", "all", "--where", "size >"); r.code != 1 {
+		t.Errorf("filter with an invalid predicate: exit %d, want 1", r.code)
+	}
+}
+
+// TestIndexRebase moves an indexed tree and checks that a rebase points the
+// index at its new location, so materialize finds the files again.
+func TestIndexRebase(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "olddrive/a.dat", "first")
+	writeFile(t, wd, "olddrive/sub/b.dat", "second")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "olddrive"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if err := os.Rename(filepath.Join(wd, "olddrive"), filepath.Join(wd, "backup")); err != nil {
+		t.Fatalf("move tree: %v", err)
+	}
+
+	r := runVenn(t, wd, "index", "rebase", "--dry-run", "idx", "olddrive", "backup")
+	if r.code != 0 || !strings.Contains(r.stdout, "2 paths and 0 attachments would be rewritten: 2 exist, 0 missing") {
+		t.Fatalf("rebase dry run: exit %d, stdout:\n%s\nstderr:\n%s", r.code, r.stdout, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "materialize", "idx", "out"); r.code == 0 {
+		t.Fatal("materialize before the rebase should fail")
+	}
+
+	if r := runVenn(t, wd, "index", "rebase", "idx", "olddrive", "backup"); r.code != 0 {
+		t.Fatalf("rebase: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "materialize", "idx", "out2"); r.code != 0 {
+		t.Fatalf("materialize: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if got := materializedHashes(t, filepath.Join(wd, "out2")); len(got) != 2 {
+		t.Errorf("materialized %d files, want 2: %v", len(got), got)
+	}
+}
+
+// TestMaterializeSyncDryRun checks that a sync dry run lists the extra files
+// in a materialized tree and leaves them in place.
+func TestMaterializeSyncDryRun(t *testing.T) {
+	wd := t.TempDir()
+	mustInit(t, wd)
+
+	writeFile(t, wd, "tree/a.dat", "first")
+	if r := runVenn(t, wd, "index", "add-files", "idx", "tree"); r.code != 0 {
+		t.Fatalf("add-files: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if r := runVenn(t, wd, "index", "materialize", "idx", "out"); r.code != 0 {
+		t.Fatalf("materialize: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	writeFile(t, wd, "out/stray.txt", "not in the index")
+
+	r := runVenn(t, wd, "index", "materialize", "--sync", "--dry-run", "idx", "out")
+	if r.code != 0 {
+		t.Fatalf("sync dry run: exit %d, stderr:\n%s", r.code, r.stderr)
+	}
+	if !strings.Contains(r.stdout, "delete out/stray.txt") || !strings.Contains(r.stdout, "1 extra files would be deleted") {
+		t.Errorf("sync dry run stdout:\n%s", r.stdout)
+	}
+	if _, err := os.Stat(filepath.Join(wd, "out", "stray.txt")); err != nil {
+		t.Errorf("sync dry run removed the extra file: %v", err)
+	}
+
+	if r := runVenn(t, wd, "index", "materialize", "--dry-run", "idx", "out"); r.code != 1 {
+		t.Errorf("dry run without sync: exit %d, want 1", r.code)
+	}
+}
+
 // TestErrorSurfaces covers the failure exit codes a caller relies on.
 func TestErrorSurfaces(t *testing.T) {
 	t.Run("command before init exits 1", func(t *testing.T) {
@@ -358,6 +772,9 @@ func materializedHashes(t *testing.T, root string) map[string]string {
 	t.Helper()
 	hashes := make(map[string]string)
 	walkFiles(t, root, func(path string) {
+		if filepath.Base(path) == ".venn-manifest.jsonl" {
+			return // the manifest maps files back to their sources
+		}
 		data, err := os.ReadFile(path)
 		if err != nil {
 			t.Fatalf("read materialized file %q: %v", path, err)
@@ -9,34 +9,58 @@ import (
 
 	hclog "github.com/hashicorp/go-hclog"
 	venncmd "github.com/slackpad/venn/cmd"
+	"github.com/slackpad/venn/core"
 )
 
 const (
 	appName    = "venn"
 	appVersion = "0.0.1"
+
+	// dbEnvVar names the environment variable that selects the database when
+	// no --db flag is given.
+	dbEnvVar = "VENN_DB"
 )
 
 // commands builds the registry of subcommands keyed by their full,
-// space-separated name (e.g. "index add-files").
-func commands(logger hclog.Logger) map[string]venncmd.Command {
+// space-separated name (e.g. "index add-files"), each working against the
+// database at dbPath.
+func commands(logger hclog.Logger, dbPath string) map[string]venncmd.Command {
 	return map[string]venncmd.Command{
 		// Initialization
-		"init": venncmd.DoInit(logger),
+		"init": venncmd.DoInit(logger, dbPath),
+
+		// Duplicate management
+		"dedupe":             venncmd.Dedupe(logger, dbPath),
+		"prune":              venncmd.Prune(logger, dbPath),
+		"restore-quarantine": venncmd.RestoreQuarantine(logger, dbPath),
 
 		// Index management commands
-		"index add-files":                 venncmd.IndexAddFiles(logger),
-		"index add-google-photos-takeout": venncmd.IndexAddGooglePhotosTakeout(logger),
-		"index cat":                       venncmd.IndexCat(logger),
-		"index chunk":                     venncmd.IndexChunk(logger),
-		"index ls":                        venncmd.IndexList(logger),
-		"index materialize":               venncmd.IndexMaterialize(logger),
-		"index rm":                        venncmd.IndexDelete(logger),
-		"index stats":                     venncmd.IndexStats(logger),
+		"index add-files":                 venncmd.IndexAddFiles(logger, dbPath),
+		"index add-materialized":          venncmd.IndexAddMaterialized(logger, dbPath),
+		"index add-google-photos-takeout": venncmd.IndexAddGooglePhotosTakeout(logger, dbPath),
+		"index cat":                       venncmd.IndexCat(logger, dbPath),
+		"index chunk":                     venncmd.IndexChunk(logger, dbPath),
+		"index compare":                   venncmd.IndexCompare(logger, dbPath),
+		"index dupes":                     venncmd.IndexDupes(logger, dbPath),
+		"index filter":                    venncmd.IndexFilter(logger, dbPath),
+		"index ls":                        venncmd.IndexList(logger, dbPath),
+		"index materialize":               venncmd.IndexMaterialize(logger, dbPath),
+		"index rebase":                    venncmd.IndexRebase(logger, dbPath),
+		"index refresh":                   venncmd.IndexRefresh(logger, dbPath),
+		"index rm":                        venncmd.IndexDelete(logger, dbPath),
+		"index stats":                     venncmd.IndexStats(logger, dbPath),
+		"index verify":                    venncmd.IndexVerify(logger, dbPath),
+
+		// Materialized trees
+		"materialized verify": venncmd.MaterializedVerify(logger, dbPath),
+		"whereis":             venncmd.Whereis(logger),
 
 		// Set operations
-		"set difference":   venncmd.SetDifference(logger),
-		"set intersection": venncmd.SetIntersection(logger),
-		"set union":        venncmd.SetUnion(logger),
+		"set difference":           venncmd.SetDifference(logger, dbPath),
+		"set eval":                 venncmd.SetEval(logger, dbPath),
+		"set intersection":         venncmd.SetIntersection(logger, dbPath),
+		"set symmetric-difference": venncmd.SetSymmetricDifference(logger, dbPath),
+		"set union":                venncmd.SetUnion(logger, dbPath),
 	}
 }
 
@@ -52,11 +76,43 @@ func usage(w io.Writer, cmds map[string]venncmd.Command) {
 	}
 	sort.Strings(names)
 
-	fmt.Fprintf(w, "Usage: %s [--version] [--help] <command> [<args>]\n\n", appName)
+	fmt.Fprintf(w, "Usage: %s [--version] [--help] [--db <path>] <command> [<args>]\n\n", appName)
 	fmt.Fprintln(w, "Available commands:")
 	for _, name := range names {
 		fmt.Fprintf(w, "    %-34s%s\n", name, cmds[name].Synopsis())
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "The database defaults to venn.db in the current directory. Use --db or the\n%s environment variable to select another one.\n", dbEnvVar)
+}
+
+// parseGlobalFlags consumes the global flags that precede the command name
+// and returns the database path along with the remaining arguments. The path
+// falls back to the VENN_DB environment variable when no --db flag is given,
+// and then to venn.db in the current directory.
+func parseGlobalFlags(args []string) (string, []string, error) {
+	dbPath := os.Getenv(dbEnvVar)
+	if dbPath == "" {
+		dbPath = core.DefaultDBPath
+	}
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "-db" || arg == "--db":
+			if len(args) < 2 || args[1] == "" {
+				return "", nil, fmt.Errorf("flag %s needs a path", arg)
+			}
+			dbPath = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "-db=") || strings.HasPrefix(arg, "--db="):
+			dbPath = arg[strings.IndexByte(arg, '=')+1:]
+			if dbPath == "" {
+				return "", nil, fmt.Errorf("flag %s needs a path", arg)
+			}
+			args = args[1:]
+		default:
+			return dbPath, args, nil
+		}
+	}
+	return dbPath, args, nil
 }
 
 // printHelp writes a command's help text with exactly one trailing newline.
@@ -72,7 +128,14 @@ func run(args []string, out, errOut io.Writer) int {
 		Level:  hclog.LevelFromString("INFO"),
 		Output: errOut,
 	})
-	cmds := commands(logger)
+
+	dbPath, args, err := parseGlobalFlags(args)
+	cmds := commands(logger, dbPath)
+	if err != nil {
+		fmt.Fprintf(errOut, "Error: %v\n\n", err)
+		usage(errOut, cmds)
+		return 1
+	}
 
 	if len(args) == 0 {
 		usage(errOut, cmds)
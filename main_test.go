@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -123,3 +125,49 @@ func TestRunResultHelpRoundTrip(t *testing.T) {
 		t.Errorf("errOut missing init help:\n%s", errOut)
 	}
 }
+
+// The global --db flag and VENN_DB select the database before dispatch, so a
+// command can run against a database outside the working directory.
+func TestGlobalDBFlag(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+
+	flagPath := filepath.Join(dir, "flag.db")
+	if code, _, errOut := exec("--db", flagPath, "init"); code != 0 {
+		t.Fatalf("--db init: got exit %d, errOut:\n%s", code, errOut)
+	}
+	if _, err := os.Stat(flagPath); err != nil {
+		t.Errorf("--db init did not create %s: %v", flagPath, err)
+	}
+
+	envPath := filepath.Join(dir, "env.db")
+	t.Setenv("VENN_DB", envPath)
+	if code, _, errOut := exec("init"); code != 0 {
+		t.Fatalf("VENN_DB init: got exit %d, errOut:\n%s", code, errOut)
+	}
+	if _, err := os.Stat(envPath); err != nil {
+		t.Errorf("VENN_DB init did not create %s: %v", envPath, err)
+	}
+
+	// The flag wins over the environment, so this finds the existing database.
+	if code, _, errOut := exec("--db="+flagPath, "init"); code != 1 || !strings.Contains(errOut, "already initialized") {
+		t.Errorf("--db= init: got exit %d, errOut:\n%s", code, errOut)
+	}
+
+	if _, err := os.Stat("venn.db"); err == nil {
+		t.Error("venn.db was created in the working directory")
+	}
+}
+
+func TestGlobalDBFlagMissingPath(t *testing.T) {
+	code, out, errOut := exec("--db")
+	if code != 1 {
+		t.Errorf("got exit %d, want 1", code)
+	}
+	if out != "" {
+		t.Errorf("out = %q, want empty", out)
+	}
+	if !strings.Contains(errOut, "needs a path") || !strings.Contains(errOut, "Usage: venn") {
+		t.Errorf("errOut missing error and usage:\n%s", errOut)
+	}
+}